@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dfinster/branch-wrangler/internal/github"
+)
+
+func newAuthCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "auth",
+		Short: "Log in to GitHub, log out, or check the token in use",
+		Long: `Auth manages the GitHub token Branch Wrangler uses. The host is the one
+named by --host or the config file, else the host of the origin remote.
+` + authHelp,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "login",
+		Short: "Log in through the browser and save the token",
+		Long: `Login runs the OAuth device flow, even when a valid token is already
+available, and saves the new token to the config file.`,
+		Args: cobra.NoArgs,
+		Run: run(func(cmd *cobra.Command, args []string) error {
+			return runLogin(cmd)
+		}),
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "logout",
+		Short: "Remove the saved token from the config file",
+		Long: `Logout removes the token saved for the host from the config file. Tokens
+from the environment, the gh CLI or git credential helpers are not
+touched.`,
+		Args: cobra.NoArgs,
+		Run: run(func(cmd *cobra.Command, args []string) error {
+			return runLogout(cmd)
+		}),
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Show which token is used and whether GitHub accepts it",
+		Long: `Status finds the token the other commands would use, checks it with
+GitHub and, inside a repository, reports any permissions it lacks. It
+exits 1 when there is no usable token.`,
+		Args: cobra.NoArgs,
+		Run: run(func(cmd *cobra.Command, args []string) error {
+			return runAuthStatus(cmd)
+		}),
+	})
+
+	return cmd
+}
+
+// runLogin forces the device flow, even when a valid token is already
+// available, and saves the new token.
+func runLogin(cmd *cobra.Command) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	auth := newAuthConfig(cmd, cfg, resolveHost(cmd, cfg, originHost(cfg)))
+	if _, err := auth.DeviceFlow(context.Background()); err != nil {
+		return fmt.Errorf("GitHub login failed: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Logged in to %s. Token saved to %s\n", auth.Host, cfg.Path())
+	if os.Getenv(auth.TokenEnv) != "" {
+		fmt.Fprintf(os.Stderr, "Note: %s is set and takes precedence over the saved token.\n", auth.TokenEnv)
+	}
+	return nil
+}
+
+// runLogout removes the stored token from the config file.
+func runLogout(cmd *cobra.Command) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	auth := newAuthConfig(cmd, cfg, resolveHost(cmd, cfg, originHost(cfg)))
+	removed, err := auth.Logout()
+	if err != nil {
+		return fmt.Errorf("failed to remove token: %w", err)
+	}
+
+	if removed {
+		fmt.Fprintf(os.Stderr, "Removed %s token from %s\n", auth.Host, cfg.Path())
+	} else {
+		fmt.Fprintf(os.Stderr, "No %s token stored in %s\n", auth.Host, cfg.Path())
+	}
+	if os.Getenv(auth.TokenEnv) != "" {
+		fmt.Fprintf(os.Stderr, "Note: %s is still set and will be used.\n", auth.TokenEnv)
+	}
+	return nil
+}
+
+// runAuthStatus reports the token that would be used without starting a
+// login when there is none.
+func runAuthStatus(cmd *cobra.Command) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	origin, inRepo := originRemote(cfg)
+	auth := newAuthConfig(cmd, cfg, resolveHost(cmd, cfg, origin.Host))
+	token, err := auth.GetToken()
+	if errors.Is(err, github.ErrNoToken) {
+		return fmt.Errorf("not logged in to %s: run \"branch-wrangler auth login\" or set %s", auth.Host, auth.TokenEnv)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Inside a repository, the client also works out missing permissions.
+	if inRepo && origin.Host == auth.Host {
+		client, err := github.NewClient(auth, origin.Owner, origin.Name)
+		if err != nil {
+			return err
+		}
+		info := client.TokenInfo()
+		fmt.Printf("Logged in to %s with the %s\n", auth.Host, info.Summary())
+		if missing := info.MissingSummary(); missing != "" {
+			fmt.Printf("Warning: %s in %s/%s\n", missing, origin.Owner, origin.Name)
+		}
+		return nil
+	}
+
+	if err := auth.ValidateToken(token); err != nil {
+		return err
+	}
+	fmt.Printf("Logged in to %s with the %s token\n", auth.Host, auth.SourceDescription())
+	return nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dfinster/branch-wrangler/internal/config"
+	"github.com/dfinster/branch-wrangler/internal/git"
+)
+
+// Exit codes for --delete-stale. Errors that stop the cleanup before it
+// starts exit 1 like every other command.
+const (
+	exitDeleted        = 0
+	exitNothingToDo    = 2
+	exitPartialFailure = 3
+)
+
+// jsonCleanup is the document printed by --delete-stale --json.
+type jsonCleanup struct {
+	DryRun    bool           `json:"dry_run"`
+	Deletions []jsonDeletion `json:"deletions"`
+	Skipped   []git.Deletion `json:"skipped"`
+}
+
+type jsonDeletion struct {
+	git.Deletion
+	Deleted bool   `json:"deleted"`
+	Error   string `json:"error,omitempty"`
+}
+
+// runDeleteStale deletes branches whose work is merged and whose remote
+// branch is gone, and with --include-merged those fully merged into a
+// base branch. With --dry-run it prints the git commands instead. It
+// returns the exit code.
+func runDeleteStale(cmd *cobra.Command) (int, error) {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return 1, err
+	}
+	states, err := cleanStates(cmd, cfg)
+	if err != nil {
+		return 1, err
+	}
+
+	ctx := context.Background()
+	sess, err := newSession(ctx, cmd, cfg, false)
+	if err != nil {
+		return 1, err
+	}
+
+	branches, err := sess.classifier.ClassifyAllBranches(ctx)
+	if err != nil {
+		return 1, err
+	}
+	checkedOut, err := sess.git.CheckedOutBranches()
+	if err != nil {
+		return 1, err
+	}
+
+	plan := git.PlanCleanup(branches, states, sess.classifier.BaseBranches(ctx), checkedOut)
+
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	jsonFlag, _ := cmd.Flags().GetBool("json")
+
+	byName := make(map[string]git.Branch, len(branches))
+	for _, b := range branches {
+		byName[b.Name] = b
+	}
+
+	report := jsonCleanup{DryRun: dryRun, Deletions: []jsonDeletion{}, Skipped: plan.Skipped}
+	var deleted []git.DeletedBranch
+	failed := 0
+	for _, d := range plan.Delete {
+		result := jsonDeletion{Deletion: d}
+		if !dryRun {
+			if err := sess.git.DeleteBranch(d.Branch); err != nil {
+				result.Error = err.Error()
+				failed++
+			} else {
+				result.Deleted = true
+				deleted = append(deleted, deletedBranch(byName[d.Branch]))
+			}
+		}
+		report.Deletions = append(report.Deletions, result)
+	}
+	if len(deleted) > 0 {
+		if err := recordDeletions(sess.git, deleted); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; undo will not be able to restore these branches\n", err)
+		}
+	}
+
+	if jsonFlag {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return 1, err
+		}
+		fmt.Println(string(data))
+	} else {
+		printCleanup(report)
+	}
+
+	switch {
+	case len(plan.Delete) == 0:
+		return exitNothingToDo, nil
+	case failed > 0:
+		return exitPartialFailure, nil
+	default:
+		return exitDeleted, nil
+	}
+}
+
+// printCleanup reports the cleanup for people. A dry run prints the git
+// commands on stdout, so they can be reviewed and piped to a shell.
+func printCleanup(report jsonCleanup) {
+	for _, d := range report.Skipped {
+		fmt.Fprintf(os.Stderr, "Skipping %s: %s\n", d.Branch, d.Reason)
+	}
+
+	if len(report.Deletions) == 0 {
+		fmt.Fprintln(os.Stderr, "Nothing to delete.")
+		return
+	}
+
+	for _, d := range report.Deletions {
+		switch {
+		case report.DryRun:
+			fmt.Printf("%s  # %s\n", d.Command, d.Reason)
+		case d.Deleted:
+			fmt.Printf("Deleted %s (was %.7s): %s\n", d.Branch, d.Commit, d.Reason)
+		default:
+			fmt.Fprintf(os.Stderr, "Failed to delete %s: %s\n", d.Branch, d.Error)
+		}
+	}
+}
+
+// cleanStates returns the states clean deletes: STALE_LOCAL, plus
+// FULLY_MERGED_BASE with --include-merged, narrowed by --only.
+func cleanStates(cmd *cobra.Command, cfg *config.Config) ([]git.BranchState, error) {
+	allowed := []git.BranchState{git.StaleLocal}
+	includeMerged, _ := cmd.Flags().GetBool("include-merged")
+	if includeMerged {
+		allowed = append(allowed, git.FullyMergedBase)
+	}
+
+	names, _ := cmd.Flags().GetStringSlice("only")
+	if len(names) == 0 {
+		return allowed, nil
+	}
+	only, err := parseStates(names, cfg.SavedFilterSets)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []git.BranchState
+	for _, state := range only {
+		switch {
+		case slices.Contains(allowed, state):
+			if !slices.Contains(states, state) {
+				states = append(states, state)
+			}
+		case state == git.FullyMergedBase:
+			return nil, fmt.Errorf("deleting %s branches needs --include-merged", state)
+		default:
+			return nil, fmt.Errorf("clean never deletes %s branches; --only takes %s or %s", state, git.StaleLocal, git.FullyMergedBase)
+		}
+	}
+	return states, nil
+}
+
+// deletedBranch records what undo needs to restore b.
+func deletedBranch(b git.Branch) git.DeletedBranch {
+	d := git.DeletedBranch{Name: b.Name, Commit: b.LastCommitSHA, DeletedAt: time.Now().UTC()}
+	if b.UpstreamRemote != "" && b.UpstreamBranch != "" {
+		d.UpstreamRemote = b.UpstreamRemote
+		d.UpstreamMerge = "refs/heads/" + b.UpstreamBranch
+	}
+	return d
+}
+
+func recordDeletions(gitClient *git.Client, deleted []git.DeletedBranch) error {
+	dir, err := config.GetStateDir()
+	if err != nil {
+		return fmt.Errorf("failed to locate state directory: %w", err)
+	}
+	return gitClient.RecordDeletions(dir, deleted)
+}
+
+// runUndo restores the branches the last clean in this repository
+// deleted. Branches that cannot be restored stay in the undo log.
+func runUndo(cmd *cobra.Command) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+	gitClient := git.NewClient(cwd)
+	if !gitClient.IsGitRepo() {
+		return fmt.Errorf("not a git repository")
+	}
+
+	dir, err := config.GetStateDir()
+	if err != nil {
+		return fmt.Errorf("failed to locate state directory: %w", err)
+	}
+	deleted, err := gitClient.LastDeletions(dir)
+	if err != nil {
+		return err
+	}
+	if len(deleted) == 0 {
+		fmt.Fprintln(os.Stderr, "Nothing to undo.")
+		return nil
+	}
+
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	var remaining []git.DeletedBranch
+	for _, b := range deleted {
+		if dryRun {
+			fmt.Printf("git branch %s %s\n", b.Name, b.Commit)
+			continue
+		}
+		if err := gitClient.RestoreBranch(b); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to restore %s: %v\n", b.Name, err)
+			remaining = append(remaining, b)
+			continue
+		}
+		fmt.Printf("Restored %s at %.7s\n", b.Name, b.Commit)
+	}
+	if dryRun {
+		return nil
+	}
+
+	if err := gitClient.RecordDeletions(dir, remaining); err != nil {
+		return err
+	}
+	if len(remaining) > 0 {
+		return fmt.Errorf("%d of %d branches could not be restored", len(remaining), len(deleted))
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// authHelp documents how commands that talk to GitHub find a token.
+const authHelp = `
+Authentication:
+  Branch Wrangler needs a GitHub token to read pull requests. It uses the
+  first one it finds:
+
+    1. Environment variable: GITHUB_TOKEN, or GH_ENTERPRISE_TOKEN for
+       GitHub Enterprise Server.
+    2. Config file: the token: key (hosts.<host>.token for Enterprise
+       Server), then the file named by --github-token-path. Tokens saved
+       by the gh CLI and git credential helpers come next, unless
+       use_gh_cli_token or use_git_credentials is false.
+    3. Browser login: the OAuth device flow, run by "branch-wrangler auth
+       login" or automatically when no token is found. The token is saved
+       to the config file.
+
+  A classic personal access token needs the repo scope, or public_repo
+  for public repositories only. A fine-grained token needs read access to
+  contents and pull requests.`
+
+// run adapts a command to cobra, reporting errors the way every
+// branch-wrangler command does.
+func run(fn func(cmd *cobra.Command, args []string) error) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		if err := fn(cmd, args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// addListFlags registers the filters shared by list and its root alias.
+func addListFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringSlice("state", nil, "Show only branches in these states: state IDs such as STALE_LOCAL, or saved filter set names")
+	flags.String("search", "", "Show only branches whose names contain this text")
+	completeFlag(cmd, "state", completeStates)
+	completeFlag(cmd, "search", cobra.NoFileCompletions)
+}
+
+// addCleanFlags registers the options shared by clean and its root alias.
+func addCleanFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.Bool("include-merged", false, "Also delete branches fully merged into a base branch")
+	flags.StringSlice("only", nil, "Delete only branches in these states: STALE_LOCAL, FULLY_MERGED_BASE or saved filter set names")
+	flags.Bool("dry-run", false, "Print the git commands that would run without running them")
+	completeFlag(cmd, "only", completeCleanStates)
+}
+
+func newListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List branches and their states",
+		Long: `List classifies every local branch and prints a table of its state,
+ahead/behind counts, age, author and pull request. Colors are used on a
+terminal only. With --json it prints the versioned document described by
+docs/schema/branches.schema.json instead.
+` + authHelp,
+		Args: cobra.NoArgs,
+		Run: run(func(cmd *cobra.Command, args []string) error {
+			if jsonFlag, _ := cmd.Flags().GetBool("json"); jsonFlag {
+				return runJSON(cmd)
+			}
+			return runList(cmd)
+		}),
+	}
+	addListFlags(cmd)
+	cmd.Flags().Bool("json", false, "Print JSON instead of a table")
+	return cmd
+}
+
+func newCleanCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "clean",
+		Short: "Delete branches that are safe to delete",
+		Long: `Clean deletes branches merged on GitHub whose remote branch is gone
+(STALE_LOCAL) with git branch -d, and with --include-merged those fully
+merged into a base branch. The current branch, base branches and
+branches checked out in any worktree are never deleted. "branch-wrangler
+undo" restores what the last clean deleted.
+
+Exit status is 0 when branches were deleted (or would be, with
+--dry-run), 2 when there was nothing to delete, 3 when some deletions
+failed and 1 on any other error.
+` + authHelp,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			code, err := runDeleteStale(cmd)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			os.Exit(code)
+		},
+	}
+	addCleanFlags(cmd)
+	cmd.Flags().Bool("json", false, "Print the plan and results as JSON")
+	return cmd
+}
+
+func newUndoCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "undo",
+		Short: "Restore the branches the last clean deleted",
+		Long: `Undo recreates the branches the last clean in this repository deleted,
+at the commits they pointed to, with their upstreams. Branches that
+cannot be restored, for example because the name is taken again, are
+kept for the next undo.`,
+		Args: cobra.NoArgs,
+		Run: run(func(cmd *cobra.Command, args []string) error {
+			return runUndo(cmd)
+		}),
+	}
+	cmd.Flags().Bool("dry-run", false, "Print the git commands that would run without running them")
+	return cmd
+}
+
+func newVersionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Show version information",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			handleVersionCommand(cmd)
+		},
+	}
+	cmd.Flags().Bool("json", false, "Print version information as JSON")
+	return cmd
+}
+
+func newTUICmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "tui",
+		Short: "Browse and manage branches interactively (the default)",
+		Long: `Tui opens the interactive branch browser. Running branch-wrangler
+without a command does the same.
+` + authHelp,
+		Args: cobra.NoArgs,
+		Run: run(func(cmd *cobra.Command, args []string) error {
+			return runTUI(cmd)
+		}),
+	}
+}
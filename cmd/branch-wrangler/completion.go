@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dfinster/branch-wrangler/internal/git"
+)
+
+// completionShells are the shells completion scripts are generated for.
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// cleanableStates are the states clean can delete, and so the ones --only
+// accepts.
+var cleanableStates = []git.BranchState{git.StaleLocal, git.FullyMergedBase}
+
+func newCompletionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "completion bash|zsh|fish|powershell",
+		Short: "Generate a shell completion script",
+		Long: `Completion prints a completion script for the given shell. Besides
+commands and flags, it completes branch names for --explain, state IDs and
+saved filter set names for --state and --only. To load it in the current
+shell:
+
+  bash:        source <(branch-wrangler completion bash)
+  zsh:         source <(branch-wrangler completion zsh)
+  fish:        branch-wrangler completion fish | source
+  powershell:  branch-wrangler completion powershell | Out-String | Invoke-Expression
+
+To load it in every new shell, add the same line to your shell's startup
+file (~/.bashrc, ~/.zshrc, ~/.config/fish/config.fish or $PROFILE).`,
+		ValidArgs: completionShells,
+		Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		Run: run(func(cmd *cobra.Command, args []string) error {
+			return writeCompletion(cmd.Root(), os.Stdout, args[0])
+		}),
+	}
+}
+
+// writeCompletion writes the completion script for shell to w.
+func writeCompletion(root *cobra.Command, w io.Writer, shell string) error {
+	switch shell {
+	case "bash":
+		return root.GenBashCompletionV2(w, true)
+	case "zsh":
+		return root.GenZshCompletion(w)
+	case "fish":
+		return root.GenFishCompletion(w, true)
+	case "powershell":
+		return root.GenPowerShellCompletionWithDesc(w)
+	default:
+		return fmt.Errorf("unsupported shell %q: want bash, zsh, fish or powershell", shell)
+	}
+}
+
+// completeFlag registers fn to complete the values of flag on cmd.
+func completeFlag(cmd *cobra.Command, flag string, fn cobra.CompletionFunc) {
+	if err := cmd.RegisterFlagCompletionFunc(flag, fn); err != nil {
+		panic(err)
+	}
+}
+
+// completeBranches completes local branch names.
+func completeBranches(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	branches, err := git.NewClient(cwd).ListBranches()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var names []cobra.Completion
+	for _, b := range branches {
+		if strings.HasPrefix(b.Name, toComplete) {
+			names = append(names, b.Name)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeStates completes --state with every state ID and saved filter
+// set name.
+func completeStates(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	return stateCompletions(cmd, toComplete, git.AllStates), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeCleanStates completes --only with the states clean deletes and
+// the saved filter sets made of them.
+func completeCleanStates(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	return stateCompletions(cmd, toComplete, cleanableStates), cobra.ShellCompDirectiveNoFileComp
+}
+
+// stateCompletions offers the IDs of states and the names of saved filter
+// sets using only those states. Flags take comma-separated lists, so only
+// the text after the last comma is completed, and states already in the
+// list are not offered again.
+func stateCompletions(cmd *cobra.Command, toComplete string, states []git.BranchState) []cobra.Completion {
+	done, word := "", toComplete
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		done, word = toComplete[:i+1], toComplete[i+1:]
+	}
+	given := strings.Split(strings.TrimSuffix(done, ","), ",")
+
+	var completions []cobra.Completion
+	for _, state := range states {
+		if !hasPrefixFold(string(state), word) || slices.ContainsFunc(given, func(id string) bool { return strings.EqualFold(id, string(state)) }) {
+			continue
+		}
+		completions = append(completions, cobra.CompletionWithDesc(done+string(state), state.DisplayName()))
+	}
+
+	// Completion must not fail because of a broken config file; it just
+	// offers no filter sets.
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return completions
+	}
+	for _, set := range cfg.SavedFilterSets {
+		if set.Name == "" || !hasPrefixFold(set.Name, word) || !onlyStates(set.Filter, states) {
+			continue
+		}
+		completions = append(completions, cobra.CompletionWithDesc(done+set.Name, "Saved filter set: "+strings.Join(set.Filter, ", ")))
+	}
+	return completions
+}
+
+// onlyStates reports whether every ID in ids names one of states.
+func onlyStates(ids []string, states []git.BranchState) bool {
+	for _, id := range ids {
+		state, ok := git.ParseBranchState(id)
+		if !ok || !slices.Contains(states, state) {
+			return false
+		}
+	}
+	return len(ids) > 0
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestStateCompletions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	config := `saved_filter_sets:
+  - name: Stale branches
+    filter: [STALE_LOCAL]
+  - name: Has PR
+    filter: [OPEN_PR, DRAFT_PR]
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		fn         cobra.CompletionFunc
+		toComplete string
+		want       []string
+	}{
+		{"state prefix", completeStates, "op", []string{"OPEN_PR"}},
+		{"state filter set", completeStates, "has", []string{"Has PR"}},
+		{"state after comma", completeStates, "OPEN_PR,dr", []string{"OPEN_PR,DRAFT_PR"}},
+		{"state not repeated", completeStates, "open_pr,OPEN", nil},
+		{"only", completeCleanStates, "", []string{"STALE_LOCAL", "FULLY_MERGED_BASE", "Stale branches"}},
+		{"only after comma", completeCleanStates, "STALE_LOCAL,", []string{"STALE_LOCAL,FULLY_MERGED_BASE", "STALE_LOCAL,Stale branches"}},
+		{"only unknown", completeCleanStates, "OPEN", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().String("config", path, "")
+
+			completions, directive := tt.fn(cmd, nil, tt.toComplete)
+			var got []string
+			for _, c := range completions {
+				got = append(got, strings.SplitN(c, "\t", 2)[0])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("completions for %q = %q, want %q", tt.toComplete, got, tt.want)
+			}
+			if directive != cobra.ShellCompDirectiveNoFileComp {
+				t.Errorf("directive = %v, want ShellCompDirectiveNoFileComp", directive)
+			}
+		})
+	}
+}
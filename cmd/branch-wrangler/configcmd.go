@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/dfinster/branch-wrangler/internal/config"
+	"github.com/dfinster/branch-wrangler/internal/git"
+)
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Show, edit or check the config file",
+		Long: `Config works on the config file named by --config, by default
+$XDG_CONFIG_HOME/branch-wrangler/config.yml (~/.config/branch-wrangler/config.yml
+when XDG_CONFIG_HOME is unset).`,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show",
+		Short: "Print the effective configuration with tokens hidden",
+		Long: `Show prints the configuration after defaults and command-line flags are
+applied. Tokens are replaced with a placeholder.`,
+		Args: cobra.NoArgs,
+		Run: run(func(cmd *cobra.Command, args []string) error {
+			return runConfigShow(cmd)
+		}),
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "edit",
+		Short: "Open the config file in $VISUAL or $EDITOR",
+		Long: `Edit opens the config file in $VISUAL, $EDITOR or a platform default,
+creating it first with the default settings commented out if it does not
+exist, and validates it after the editor exits.`,
+		Args: cobra.NoArgs,
+		Run: run(func(cmd *cobra.Command, args []string) error {
+			return runConfigEdit(cmd)
+		}),
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "validate",
+		Short: "Check the config file for mistakes",
+		Long: `Validate parses the config file and reports settings that cannot work,
+such as invalid base branch patterns or unknown states in saved filter
+sets. Unknown keys are reported as warnings. It exits 1 when there are
+errors.`,
+		Args: cobra.NoArgs,
+		Run: run(func(cmd *cobra.Command, args []string) error {
+			return runConfigValidate(cmd)
+		}),
+	})
+
+	return cmd
+}
+
+const redacted = "<redacted>"
+
+func runConfigShow(cmd *cobra.Command) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	shown := *cfg
+	if shown.Token != "" {
+		shown.Token = redacted
+	}
+	if len(cfg.Hosts) > 0 {
+		shown.Hosts = make(map[string]config.HostConfig, len(cfg.Hosts))
+		for host, hc := range cfg.Hosts {
+			if hc.Token != "" {
+				hc.Token = redacted
+			}
+			shown.Hosts[host] = hc
+		}
+	}
+
+	fmt.Printf("# %s\n", cfg.Path())
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(&shown); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func runConfigEdit(cmd *cobra.Command) error {
+	// Load without command-line overrides, which must not be saved.
+	path, _ := cmd.Flags().GetString("config")
+	cfg, err := config.Load(path)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if _, err := os.Stat(cfg.Path()); errors.Is(err, fs.ErrNotExist) {
+		if err := writeConfigTemplate(cfg.Path()); err != nil {
+			return fmt.Errorf("failed to create %s: %w", cfg.Path(), err)
+		}
+	}
+
+	editor := editorCommand()
+	edit := exec.Command(editor[0], append(editor[1:], cfg.Path())...)
+	edit.Stdin, edit.Stdout, edit.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := edit.Run(); err != nil {
+		return fmt.Errorf("editor %s failed: %w", editor[0], err)
+	}
+
+	return runConfigValidate(cmd)
+}
+
+// writeConfigTemplate creates a config file listing every default setting
+// as a comment, so the file starts out empty but shows what can be set.
+func writeConfigTemplate(path string) error {
+	var defaults strings.Builder
+	enc := yaml.NewEncoder(&defaults)
+	enc.SetIndent(2)
+	if err := enc.Encode(config.DefaultConfig()); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	var buf strings.Builder
+	buf.WriteString("# branch-wrangler configuration. Uncomment a setting to change it.\n")
+	for _, line := range strings.SplitAfter(defaults.String(), "\n") {
+		if line != "" {
+			buf.WriteString("# " + line)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(buf.String()), 0600)
+}
+
+// editorCommand returns the editor to run and its arguments.
+func editorCommand() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(env)); len(fields) > 0 {
+			return fields
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+func runConfigValidate(cmd *cobra.Command) error {
+	path, _ := cmd.Flags().GetString("config")
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range cfg.UnknownKeys() {
+		fmt.Fprintf(os.Stderr, "Warning: %s: unknown key %q\n", cfg.Path(), key)
+	}
+
+	errs := cfg.Validate()
+	for i, set := range cfg.SavedFilterSets {
+		for _, id := range set.Filter {
+			if _, ok := git.ParseBranchState(id); !ok {
+				errs = append(errs, fmt.Errorf("saved_filter_sets[%d]: unknown state %q", i, id))
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		fmt.Printf("%s: OK\n", cfg.Path())
+		return nil
+	}
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", cfg.Path(), err)
+	}
+	return fmt.Errorf("%s has %d problem(s)", cfg.Path(), len(errs))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dfinster/branch-wrangler/internal/config"
+)
+
+func TestConfigEditTemplateSurvivesSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "branch-wrangler", "config.yml")
+	t.Setenv("VISUAL", "true")
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("config", path, "")
+	if err := runConfigEdit(cmd); err != nil {
+		t.Fatalf("runConfigEdit() error = %v", err)
+	}
+	template, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != string(template) {
+		t.Errorf("Save() changed the template:\n%s\nwant\n%s", saved, template)
+	}
+
+	reloaded, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load() after Save error = %v", err)
+	}
+	if want := config.DefaultConfig(); !reflect.DeepEqual(reloaded.SavedFilterSets, want.SavedFilterSets) || reloaded.Concurrency != want.Concurrency {
+		t.Errorf("reloaded template = %+v, want the defaults", reloaded)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dfinster/branch-wrangler/internal/git"
+	"github.com/dfinster/branch-wrangler/internal/github"
+)
+
+// jsonSchemaVersion is the version of the --json document, described by
+// docs/schema/branches.schema.json. Bump it when fields are removed or
+// change meaning; adding optional fields does not need a bump.
+const jsonSchemaVersion = 1
+
+// jsonReport is the document printed by --json.
+type jsonReport struct {
+	SchemaVersion int               `json:"schema_version"`
+	GeneratedAt   time.Time         `json:"generated_at"`
+	Repository    jsonRepository    `json:"repository"`
+	BaseBranches  []git.BaseRef     `json:"base_branches"`
+	Auth          *github.TokenInfo `json:"auth"`
+	Head          jsonHead          `json:"head"`
+	Branches      []git.Branch      `json:"branches"`
+}
+
+// jsonRepository is the GitHub repository pull requests were looked up in.
+type jsonRepository struct {
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+}
+
+// jsonHead is the repository-level state of HEAD.
+type jsonHead struct {
+	Branch    string        `json:"branch,omitempty"`
+	Detached  bool          `json:"detached"`
+	Commit    string        `json:"commit,omitempty"`
+	Operation git.Operation `json:"operation,omitempty"`
+}
+
+func runJSON(cmd *cobra.Command) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	states, err := stateFilter(cmd, cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	sess, err := newSession(ctx, cmd, cfg, false)
+	if err != nil {
+		return err
+	}
+
+	branches, err := sess.classifier.ClassifyAllBranches(ctx)
+	if err != nil {
+		return err
+	}
+
+	status, err := sess.git.GetStatus()
+	if err != nil {
+		return err
+	}
+
+	report := newJSONReport(sess.owner, sess.repo, sess.classifier.BaseBranches(ctx), sess.github.TokenInfo(),
+		status, filterBranches(cmd, states, branches), time.Now())
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// newJSONReport builds the --json document. Lists are never null, so
+// consumers can iterate them without checking.
+func newJSONReport(owner, repo string, bases []git.BaseRef, auth *github.TokenInfo, status git.GitStatus, branches []git.Branch, now time.Time) jsonReport {
+	report := jsonReport{
+		SchemaVersion: jsonSchemaVersion,
+		GeneratedAt:   now.UTC(),
+		Repository:    jsonRepository{Owner: owner, Name: repo},
+		BaseBranches:  append([]git.BaseRef{}, bases...),
+		Auth:          &github.TokenInfo{},
+		Head: jsonHead{
+			Branch:    status.CurrentBranch,
+			Detached:  status.IsDetached,
+			Commit:    status.HeadCommit,
+			Operation: status.Operation,
+		},
+		Branches: make([]git.Branch, 0, len(branches)),
+	}
+	if auth != nil {
+		*report.Auth = *auth
+	}
+	if report.Auth.Scopes == nil {
+		report.Auth.Scopes = []string{}
+	}
+
+	for _, b := range branches {
+		if b.Flags == nil {
+			b.Flags = []git.BranchFlag{}
+		}
+		report.Branches = append(report.Branches, b)
+	}
+	return report
+}
+
+// runExplain classifies one branch and prints the trace of checks that
+// decided its state.
+func runExplain(cmd *cobra.Command, name string) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	sess, err := newSession(ctx, cmd, cfg, false)
+	if err != nil {
+		return err
+	}
+
+	branches, err := sess.git.ListBranches()
+	if err != nil {
+		return err
+	}
+
+	for _, branch := range branches {
+		if branch.Name != name {
+			continue
+		}
+		if err := sess.classifier.ClassifyBranch(ctx, &branch); err != nil {
+			return fmt.Errorf("failed to classify branch %s: %w", name, err)
+		}
+		_ = sess.github.SaveCache()
+
+		fmt.Printf("Branch: %s\n", branch.Name)
+		fmt.Printf("State:  %s (%s)\n\n", branch.State, branch.State.DisplayName())
+		fmt.Print(git.FormatTrace(branch))
+		return nil
+	}
+
+	return fmt.Errorf("no local branch named %s", name)
+}
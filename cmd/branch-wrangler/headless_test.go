@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dfinster/branch-wrangler/internal/git"
+	"github.com/dfinster/branch-wrangler/internal/github"
+)
+
+const schemaPath = "../../docs/schema/branches.schema.json"
+
+// fullReport returns a report with every optional field set, so that the
+// schema check sees all of them.
+func fullReport() jsonReport {
+	branch := git.Branch{
+		Name:           "feature",
+		State:          git.FullyMergedBase,
+		LastCommit:     time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Author:         "Ann",
+		Ahead:          1,
+		Behind:         2,
+		TrackingRef:    "origin/feature",
+		PRNumber:       7,
+		PRTitle:        "Add feature",
+		PRURL:          "https://github.com/octo/repo/pull/7",
+		IsCurrent:      true,
+		LastCommitSHA:  "0123456789abcdef0123456789abcdef01234567",
+		UpstreamRemote: "origin",
+		UpstreamBranch: "feature",
+		PushRemote:     "fork",
+		PushRef:        "fork/feature",
+		TrackingGone:   true,
+		MergedInto:     "origin/main",
+		MergedBy:       "89abcdef0123456789abcdef0123456789abcdef",
+		MergeMethod:    git.MergedBySquash,
+		RenamedTo:      "feature-2",
+		Flags:          []git.BranchFlag{git.FlagAhead, git.FlagHasPR},
+		Trace:          []git.TraceStep{{Rule: "pull requests", Source: "GitHub", Result: "1 found", Err: "timeout"}},
+	}
+	auth := &github.TokenInfo{Source: github.SourceEnv, Type: "classic", Scopes: []string{"repo"}, Missing: []string{"read:org"}}
+	status := git.GitStatus{CurrentBranch: "feature", HeadCommit: branch.LastCommitSHA, Operation: git.OpRebase}
+	bases := []git.BaseRef{{Name: "main", Ref: "origin/main"}}
+
+	return newJSONReport("octo", "repo", bases, auth, status, []git.Branch{branch}, time.Date(2026, 2, 3, 4, 5, 6, 0, time.UTC))
+}
+
+func loadSchema(t *testing.T) map[string]any {
+	t.Helper()
+	data, err := os.ReadFile(schemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+	return schema
+}
+
+func toJSONValue(t *testing.T, v any) any {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// TestJSONReportMatchesSchema fails when the --json output and
+// docs/schema/branches.schema.json drift apart in either direction.
+func TestJSONReportMatchesSchema(t *testing.T) {
+	schema := loadSchema(t)
+	v := &schemaValidator{root: schema, seen: make(map[string]bool)}
+
+	v.validate("$", schema, toJSONValue(t, fullReport()))
+	for _, err := range v.errs {
+		t.Errorf("output does not match schema: %s", err)
+	}
+
+	// Every property the schema describes should appear in a full report.
+	for _, path := range v.properties(schema, "$") {
+		if !v.seen[path] {
+			t.Errorf("schema property %s never appears in the output", path)
+		}
+	}
+
+	// A minimal report must be valid too: no nulls where arrays are expected.
+	v = &schemaValidator{root: schema, seen: make(map[string]bool)}
+	minimal := newJSONReport("octo", "repo", nil, nil, git.GitStatus{IsDetached: true}, []git.Branch{{Name: "x", State: git.NoCommits}}, time.Now())
+	v.validate("$", schema, toJSONValue(t, minimal))
+	for _, err := range v.errs {
+		t.Errorf("minimal output does not match schema: %s", err)
+	}
+}
+
+func TestJSONSchemaEnums(t *testing.T) {
+	schema := loadSchema(t)
+	props := func(path ...string) map[string]any {
+		node := schema
+		for _, key := range path {
+			node = node[key].(map[string]any)
+		}
+		return node
+	}
+	enum := func(node map[string]any) []string {
+		var out []string
+		for _, v := range node["enum"].([]any) {
+			out = append(out, v.(string))
+		}
+		sort.Strings(out)
+		return out
+	}
+	sorted := func(values ...string) []string {
+		sort.Strings(values)
+		return values
+	}
+
+	branch := []string{"$defs", "branch", "properties"}
+
+	var states []string
+	for _, s := range git.AllStates {
+		states = append(states, string(s))
+	}
+	if got := enum(props(append(branch, "state")...)); !reflect.DeepEqual(got, sorted(states...)) {
+		t.Errorf("schema states = %v, want %v", got, sorted(states...))
+	}
+
+	var flags []string
+	for _, f := range git.AllFlags {
+		flags = append(flags, string(f))
+	}
+	if got := enum(props(append(branch, "flags", "items")...)); !reflect.DeepEqual(got, sorted(flags...)) {
+		t.Errorf("schema flags = %v, want %v", got, sorted(flags...))
+	}
+
+	methods := sorted(git.MergedByMerge, git.MergedBySquash, git.MergedByRebase, git.MergedByNoOp)
+	if got := enum(props(append(branch, "merge_method")...)); !reflect.DeepEqual(got, methods) {
+		t.Errorf("schema merge methods = %v, want %v", got, methods)
+	}
+
+	if got := props("properties", "schema_version")["const"]; got != float64(jsonSchemaVersion) {
+		t.Errorf("schema_version const = %v, want %d", got, jsonSchemaVersion)
+	}
+}
+
+// schemaValidator checks a document against the subset of JSON Schema the
+// schema file uses, recording each property path it sees.
+type schemaValidator struct {
+	root map[string]any
+	errs []string
+	seen map[string]bool
+}
+
+func (v *schemaValidator) resolve(node map[string]any) map[string]any {
+	if ref, ok := node["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/$defs/")
+		return v.root["$defs"].(map[string]any)[name].(map[string]any)
+	}
+	return node
+}
+
+func (v *schemaValidator) fail(path, format string, args ...any) {
+	v.errs = append(v.errs, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *schemaValidator) validate(path string, node map[string]any, value any) {
+	node = v.resolve(node)
+	v.seen[path] = true
+
+	if want, ok := node["const"]; ok && value != want {
+		v.fail(path, "got %v, want %v", value, want)
+	}
+	if enum, ok := node["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			found = found || e == value
+		}
+		if !found {
+			v.fail(path, "%v not in %v", value, enum)
+		}
+	}
+
+	switch node["type"] {
+	case "string":
+		if _, ok := value.(string); !ok {
+			v.fail(path, "got %T, want string", value)
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != float64(int64(n)) {
+			v.fail(path, "got %v, want integer", value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			v.fail(path, "got %T, want boolean", value)
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			v.fail(path, "got %T, want array", value)
+			return
+		}
+		for _, item := range items {
+			v.validate(path+"[]", node["items"].(map[string]any), item)
+		}
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			v.fail(path, "got %T, want object", value)
+			return
+		}
+		props, _ := node["properties"].(map[string]any)
+		required, _ := node["required"].([]any)
+		for _, req := range required {
+			if _, ok := obj[req.(string)]; !ok {
+				v.fail(path, "missing required %s", req)
+			}
+		}
+		for key, val := range obj {
+			prop, ok := props[key].(map[string]any)
+			if !ok {
+				v.fail(path, "unexpected property %s", key)
+				continue
+			}
+			v.validate(path+"."+key, prop, val)
+		}
+	}
+}
+
+// properties lists the paths of every property the schema defines.
+func (v *schemaValidator) properties(node map[string]any, path string) []string {
+	node = v.resolve(node)
+	var paths []string
+	if items, ok := node["items"].(map[string]any); ok {
+		paths = append(paths, v.properties(items, path+"[]")...)
+	}
+	props, _ := node["properties"].(map[string]any)
+	for key, prop := range props {
+		paths = append(paths, path+"."+key)
+		paths = append(paths, v.properties(prop.(map[string]any), path+"."+key)...)
+	}
+	return paths
+}
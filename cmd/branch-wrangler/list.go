@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+
+	"github.com/dfinster/branch-wrangler/internal/config"
+	"github.com/dfinster/branch-wrangler/internal/git"
+	"github.com/dfinster/branch-wrangler/internal/ui"
+)
+
+// runList classifies every branch and prints the ones matching --state and
+// --search as a table.
+func runList(cmd *cobra.Command) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	// Check the filters before anything that might prompt for a login.
+	states, err := stateFilter(cmd, cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	sess, err := newSession(ctx, cmd, cfg, false)
+	if err != nil {
+		return err
+	}
+
+	branches, err := sess.classifier.ClassifyAllBranches(ctx)
+	if err != nil {
+		return err
+	}
+	branches = filterBranches(cmd, states, branches)
+
+	if len(branches) == 0 {
+		fmt.Fprintln(os.Stderr, "No branches match.")
+		return nil
+	}
+	writeTable(os.Stdout, branches, time.Now())
+	return nil
+}
+
+// stateFilter turns --state into the states to show.
+func stateFilter(cmd *cobra.Command, cfg *config.Config) ([]git.BranchState, error) {
+	names, _ := cmd.Flags().GetStringSlice("state")
+	return parseStates(names, cfg.SavedFilterSets)
+}
+
+// parseStates reads state names given on the command line. Each is a
+// state ID such as STALE_LOCAL or the name of a saved filter set, ignoring
+// case.
+func parseStates(names []string, sets []config.FilterSet) ([]git.BranchState, error) {
+	var states []git.BranchState
+	for _, name := range names {
+		if state, ok := git.ParseBranchState(name); ok {
+			states = append(states, state)
+			continue
+		}
+
+		set, ok := findFilterSet(sets, name)
+		if !ok {
+			return nil, fmt.Errorf("unknown state %q: want a state ID such as %s or a saved filter set name", name, git.StaleLocal)
+		}
+		for _, id := range set.Filter {
+			state, ok := git.ParseBranchState(id)
+			if !ok {
+				return nil, fmt.Errorf("saved filter set %q has unknown state %q", set.Name, id)
+			}
+			states = append(states, state)
+		}
+	}
+	return states, nil
+}
+
+func findFilterSet(sets []config.FilterSet, name string) (config.FilterSet, bool) {
+	for _, set := range sets {
+		if strings.EqualFold(set.Name, name) {
+			return set, true
+		}
+	}
+	return config.FilterSet{}, false
+}
+
+// filterBranches keeps the branches in one of states, if any are given,
+// whose names contain --search, using the TUI's filters.
+func filterBranches(cmd *cobra.Command, states []git.BranchState, branches []git.Branch) []git.Branch {
+	if len(states) > 0 {
+		filter := ui.NewFilter()
+		filter.SetStateFilter(states)
+		branches = filter.Apply(branches)
+	}
+	if search, _ := cmd.Flags().GetString("search"); search != "" {
+		filter := ui.NewFilter()
+		filter.SetSearchFilter(search)
+		branches = filter.Apply(branches)
+	}
+	return branches
+}
+
+// writeTable prints branches as aligned columns. States are colored when w
+// is a terminal that supports it.
+func writeTable(w io.Writer, branches []git.Branch, now time.Time) {
+	renderer := lipgloss.NewRenderer(w)
+	header := renderer.NewStyle().Bold(true)
+
+	rows := [][]string{{"BRANCH", "STATE", "AHEAD/BEHIND", "AGE", "AUTHOR", "PR"}}
+	for _, b := range branches {
+		name := "  " + b.Name
+		if b.IsCurrent {
+			name = "* " + b.Name
+		}
+		aheadBehind := ""
+		if b.TrackingRef != "" {
+			aheadBehind = fmt.Sprintf("+%d/-%d", b.Ahead, b.Behind)
+		}
+		pr := ""
+		if b.PRNumber > 0 {
+			pr = fmt.Sprintf("#%d", b.PRNumber)
+		}
+		rows = append(rows, []string{name, b.State.DisplayName(), aheadBehind, formatAge(now, b.LastCommit), b.Author, pr})
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], lipgloss.Width(cell))
+		}
+	}
+
+	for r, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			// Pad before styling so escape codes do not upset alignment.
+			if i < len(row)-1 {
+				cell += strings.Repeat(" ", widths[i]-lipgloss.Width(cell)+2)
+			}
+			switch {
+			case r == 0:
+				cell = header.Render(cell)
+			case i == 1:
+				cell = renderer.NewStyle().Foreground(ui.StateColor(branches[r-1].State)).Render(cell)
+			}
+			line.WriteString(cell)
+		}
+		fmt.Fprintln(w, strings.TrimRight(line.String(), " "))
+	}
+}
+
+// formatAge describes how long ago t was in a few characters, such as 5m,
+// 3d or 2y.
+func formatAge(now, t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	d := now.Sub(t)
+	days := int(d.Hours() / 24)
+	switch {
+	case d < time.Minute:
+		return "now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	case days < 60:
+		return fmt.Sprintf("%dd", days)
+	case days < 365:
+		return fmt.Sprintf("%dmo", days/30)
+	default:
+		return fmt.Sprintf("%dy", days/365)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dfinster/branch-wrangler/internal/config"
+	"github.com/dfinster/branch-wrangler/internal/git"
+)
+
+func TestWriteTable(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	branches := []git.Branch{
+		{Name: "main", State: git.InSync, IsCurrent: true, TrackingRef: "origin/main", LastCommit: now.Add(-2 * time.Hour), Author: "Ann"},
+		{Name: "feature/long-branch-name", State: git.OpenPR, TrackingRef: "origin/feature/long-branch-name", Ahead: 12, Behind: 3, LastCommit: now.Add(-5 * 24 * time.Hour), Author: "Bob", PRNumber: 42},
+		{Name: "wip", State: git.NoCommits},
+	}
+
+	tests := []struct {
+		name string
+		row  int
+		want []string
+	}{
+		{"header", 0, []string{"BRANCH", "STATE", "AHEAD/BEHIND", "AGE", "AUTHOR", "PR"}},
+		{"current branch", 1, []string{"* main", git.InSync.DisplayName(), "+0/-0", "2h", "Ann"}},
+		{"with PR", 2, []string{"  feature/long-branch-name", git.OpenPR.DisplayName(), "+12/-3", "5d", "Bob", "#42"}},
+		{"no tracking or commits", 3, []string{"  wip", git.NoCommits.DisplayName(), "", "-"}},
+	}
+
+	var buf bytes.Buffer
+	writeTable(&buf, branches, now)
+	out := buf.String()
+
+	// A bytes.Buffer is not a terminal, so nothing may be styled.
+	if strings.Contains(out, "\x1b[") {
+		t.Errorf("output to a non-terminal contains escape codes:\n%q", out)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != len(branches)+1 {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(branches)+1, out)
+	}
+
+	header := lines[0]
+	columns := []int{0}
+	for _, title := range []string{"STATE", "AHEAD/BEHIND", "AGE", "AUTHOR", "PR"} {
+		columns = append(columns, strings.Index(header, title))
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := lines[tt.row]
+			if strings.HasSuffix(line, " ") {
+				t.Errorf("line %q has trailing spaces", line)
+			}
+			for i, want := range tt.want {
+				// Every cell starts in its column, so the columns line up.
+				cell := line[min(columns[i], len(line)):]
+				if !strings.HasPrefix(cell, want) {
+					t.Errorf("column %d of %q = %q, want it to start with %q", i, line, cell, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name string
+		ago  time.Duration
+		want string
+	}{
+		{"just now", 59 * time.Second, "now"},
+		{"one minute", time.Minute, "1m"},
+		{"under an hour", 59*time.Minute + 59*time.Second, "59m"},
+		{"one hour", time.Hour, "1h"},
+		{"under a day", 23*time.Hour + 59*time.Minute, "23h"},
+		{"one day", day, "1d"},
+		{"under sixty days", 59 * day, "59d"},
+		{"sixty days", 60 * day, "2mo"},
+		{"under a year", 364 * day, "12mo"},
+		{"one year", 365 * day, "1y"},
+		{"several years", 3*365*day + 10*day, "3y"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatAge(now, now.Add(-tt.ago)); got != tt.want {
+				t.Errorf("formatAge(%v ago) = %q, want %q", tt.ago, got, tt.want)
+			}
+		})
+	}
+
+	if got := formatAge(now, time.Time{}); got != "-" {
+		t.Errorf("formatAge(zero) = %q, want -", got)
+	}
+}
+
+func TestParseStates(t *testing.T) {
+	sets := []config.FilterSet{
+		{Name: "Has PR", Filter: []string{"OPEN_PR", "DRAFT_PR"}},
+		{Name: "Broken", Filter: []string{"STALE_LOCAL", "NOT_A_STATE"}},
+	}
+
+	tests := []struct {
+		name    string
+		names   []string
+		want    []git.BranchState
+		wantErr string
+	}{
+		{"none", nil, nil, ""},
+		{"state IDs", []string{"STALE_LOCAL", "open_pr"}, []git.BranchState{git.StaleLocal, git.OpenPR}, ""},
+		{"filter set", []string{"has pr"}, []git.BranchState{git.OpenPR, git.DraftPR}, ""},
+		{"state and filter set", []string{"NO_COMMITS", "Has PR"}, []git.BranchState{git.NoCommits, git.OpenPR, git.DraftPR}, ""},
+		{"unknown state", []string{"STALE_LOCAL", "STALE"}, nil, `unknown state "STALE"`},
+		{"unknown state in filter set", []string{"Broken"}, nil, `saved filter set "Broken" has unknown state "NOT_A_STATE"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseStates(tt.names, sets)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseStates(%q) error = %v, want %q", tt.names, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseStates(%q) error = %v", tt.names, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseStates(%q) = %v, want %v", tt.names, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterBranches(t *testing.T) {
+	branches := []git.Branch{
+		{Name: "feature/login", State: git.OpenPR},
+		{Name: "feature/logout", State: git.StaleLocal},
+		{Name: "fix/login", State: git.StaleLocal},
+	}
+
+	tests := []struct {
+		name   string
+		states []git.BranchState
+		search string
+		want   []string
+	}{
+		{"no filters", nil, "", []string{"feature/login", "feature/logout", "fix/login"}},
+		{"state", []git.BranchState{git.StaleLocal}, "", []string{"feature/logout", "fix/login"}},
+		{"search", nil, "login", []string{"feature/login", "fix/login"}},
+		{"state and search", []git.BranchState{git.StaleLocal}, "login", []string{"fix/login"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().String("search", tt.search, "")
+
+			var got []string
+			for _, b := range filterBranches(cmd, tt.states, branches) {
+				got = append(got, b.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterBranches() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
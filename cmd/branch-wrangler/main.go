@@ -1,9 +1,11 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/cobra"
@@ -18,74 +20,213 @@ import (
 var rootCmd = &cobra.Command{
 	Use:   "branch-wrangler",
 	Short: "A cross-platform TUI for managing local Git branches",
-	Long:  `Branch Wrangler helps manage local Git branches by reconciling them with GitHub.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		// Handle version flag
-		if versionFlag, _ := cmd.Flags().GetBool("version"); versionFlag {
+	Long: `Branch Wrangler helps manage local Git branches by reconciling them with GitHub.
+
+Without a command it opens the interactive browser, like "branch-wrangler tui".
+The flags --list, --json, --delete-stale, --login, --logout and --version
+are kept as aliases for the matching commands.
+` + authHelp,
+	Args: cobra.NoArgs,
+	Run: run(func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+
+		if versionFlag, _ := flags.GetBool("version"); versionFlag {
 			handleVersionCommand(cmd)
-			return
+			return nil
 		}
-
-		if err := runTUI(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+		if logout, _ := flags.GetBool("logout"); logout {
+			return runLogout(cmd)
+		}
+		if clearCache, _ := flags.GetBool("clear-cache"); clearCache {
+			return runClearCache()
+		}
+		if login, _ := flags.GetBool("login"); login {
+			return runLogin(cmd)
+		}
+		if shell, _ := flags.GetString("completion"); shell != "" {
+			return writeCompletion(cmd, os.Stdout, shell)
 		}
-	},
+		if branch, _ := flags.GetString("explain"); branch != "" {
+			return runExplain(cmd, branch)
+		}
+		if deleteStale, _ := flags.GetBool("delete-stale"); deleteStale {
+			code, err := runDeleteStale(cmd)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			os.Exit(code)
+		}
+		if jsonFlag, _ := flags.GetBool("json"); jsonFlag {
+			return runJSON(cmd)
+		}
+		if list, _ := flags.GetBool("list"); list {
+			return runList(cmd)
+		}
+
+		return runTUI(cmd)
+	}),
 }
 
 func init() {
-	rootCmd.Flags().Bool("version", false, "Show version information")
-	rootCmd.Flags().Bool("list", false, "List branches in headless mode")
-	rootCmd.Flags().Bool("json", false, "Output in JSON format")
-	rootCmd.Flags().Bool("delete-stale", false, "Delete stale branches")
-	rootCmd.Flags().Bool("dry-run", false, "Show what would be deleted without doing it")
-	rootCmd.Flags().Bool("login", false, "Force interactive authentication")
-	rootCmd.Flags().Bool("logout", false, "Clear stored authentication token")
-	rootCmd.Flags().String("config", "", "Override default config file location")
-	rootCmd.Flags().String("github-token-path", "", "Override default token location")
-	rootCmd.Flags().StringSlice("base-branches", []string{"main", "master", "develop"}, "Override default base branches")
-	rootCmd.Flags().String("completion", "", "Generate shell completion (bash|zsh|fish)")
+	// Settings every command that reads the repository or GitHub shares.
+	persistent := rootCmd.PersistentFlags()
+	persistent.String("config", "", "Override default config file location")
+	persistent.String("host", "", "GitHub host, for GitHub Enterprise Server (default: host of the origin remote)")
+	persistent.String("github-token-path", "", "Override default token location")
+	persistent.StringSlice("base-branches", nil, "Base branches or patterns such as release/* (default: discovered from origin/HEAD or GitHub)")
+	persistent.Bool("no-cache", false, "Do not read or write the GitHub response cache")
+
+	// Aliases for the commands below, from before there were commands.
+	flags := rootCmd.Flags()
+	flags.Bool("version", false, "Show version information (same as: version)")
+	flags.Bool("list", false, "List branches in headless mode (same as: list)")
+	flags.Bool("json", false, "Output in JSON format (same as: list --json, or clean --json with --delete-stale)")
+	addListFlags(rootCmd)
+	flags.Bool("delete-stale", false, "Delete stale branches (same as: clean)")
+	addCleanFlags(rootCmd)
+	flags.String("explain", "", "Show how `branch` was classified: each check, its source and any ignored errors")
+	flags.Bool("login", false, "Force interactive authentication (same as: auth login)")
+	flags.Bool("logout", false, "Clear stored authentication token (same as: auth logout)")
+	flags.Bool("clear-cache", false, "Delete cached GitHub responses")
+	flags.String("completion", "", "Generate shell completion for bash, zsh, fish or powershell (same as: completion)")
+	completeFlag(rootCmd, "explain", completeBranches)
+	completeFlag(rootCmd, "completion", cobra.FixedCompletions(completionShells, cobra.ShellCompDirectiveNoFileComp))
+	rootCmd.MarkFlagsMutuallyExclusive("version", "list", "delete-stale", "explain", "login", "logout", "clear-cache", "completion")
+
+	rootCmd.SilenceErrors = true
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.AddCommand(
+		newTUICmd(),
+		newListCmd(),
+		newCleanCmd(),
+		newUndoCmd(),
+		newAuthCmd(),
+		newConfigCmd(),
+		newVersionCmd(),
+		newCompletionCmd(),
+	)
 }
 
-func runTUI() error {
-	cfg, err := config.Load()
+func runTUI(cmd *cobra.Command) error {
+	cfg, err := loadConfig(cmd)
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return err
 	}
 
-	cwd, err := os.Getwd()
+	ctx := context.Background()
+	sess, err := newSession(ctx, cmd, cfg, true)
 	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
+		return err
 	}
 
-	gitClient := git.NewClient(cwd)
-	if !gitClient.IsGitRepo() {
-		return fmt.Errorf("not a git repository")
+	model := ui.NewModel(ctx, sess.classifier, sess.github)
+
+	p := tea.NewProgram(model, tea.WithAltScreen())
+	_, err = p.Run()
+	return err
+}
+
+// loadConfig reads the config file named by --config (or the default
+// location) and applies command-line overrides on top of it.
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	configPath, _ := cmd.Flags().GetString("config")
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
-	remoteURL, err := gitClient.GetRemoteURL()
+	if cmd.Flags().Changed("base-branches") {
+		cfg.BaseBranches, _ = cmd.Flags().GetStringSlice("base-branches")
+	}
+
+	return cfg, nil
+}
+
+// runClearCache deletes the on-disk GitHub response cache.
+func runClearCache() error {
+	dir, err := config.GetCacheDir()
 	if err != nil {
-		return fmt.Errorf("failed to get remote URL: %w", err)
+		return fmt.Errorf("failed to locate cache directory: %w", err)
+	}
+
+	if err := github.ClearCache(dir); err != nil {
+		return fmt.Errorf("failed to clear cache: %w", err)
 	}
 
-	owner, repo, err := gitClient.ParseGitHubRepo(remoteURL)
+	fmt.Fprintf(os.Stderr, "Cleared cache in %s\n", dir)
+	return nil
+}
+
+// newAuthConfig builds the token precedence chain for host from the
+// config file and command-line flags.
+func newAuthConfig(cmd *cobra.Command, cfg *config.Config, host string) *github.AuthConfig {
+	auth := github.NewAuthConfig()
+	auth.SetHost(host, cfg.HostClientID(host))
+	auth.ConfigPath = cfg.Path()
+	auth.ConfigToken = cfg.HostToken(host)
+	auth.UseGHCLI = cfg.UseGHCLIToken
+	auth.UseGitCredentials = cfg.UseGitCredentials
+	// The token file predates Enterprise support and holds a github.com
+	// token, unless one is named explicitly.
+	if config.IsDefaultHost(host) {
+		auth.TokenPath = cfg.GitHubTokenPath
+	}
+	if cmd.Flags().Changed("github-token-path") {
+		auth.TokenPath, _ = cmd.Flags().GetString("github-token-path")
+	}
+	return auth
+}
+
+// resolveHost picks the GitHub host from --host, the host: key in the
+// config file, or the host of the origin remote, in that order.
+func resolveHost(cmd *cobra.Command, cfg *config.Config, remoteHost string) string {
+	if host, _ := cmd.Flags().GetString("host"); host != "" {
+		return host
+	}
+	if cfg.Host != "" {
+		return cfg.Host
+	}
+	if remoteHost != "" {
+		return remoteHost
+	}
+	return config.DefaultHost
+}
+
+// originHost returns the host of the origin remote of the repository in
+// the current directory, or "" outside a GitHub repository.
+func originHost(cfg *config.Config) string {
+	origin, _ := originRemote(cfg)
+	return origin.Host
+}
+
+// originRemote resolves the origin remote of the repository in the current
+// directory. ok is false outside a GitHub repository.
+func originRemote(cfg *config.Config) (origin git.RemoteRepo, ok bool) {
+	cwd, err := os.Getwd()
 	if err != nil {
-		return fmt.Errorf("not a GitHub repository: %w", err)
+		return git.RemoteRepo{}, false
 	}
 
-	githubClient, err := github.NewCachedClient(owner, repo)
+	gitClient := git.NewClient(cwd)
+	gitClient.SetHostAliases(cfg.HostAliases)
+	origin, err = gitClient.ResolveRemote("origin")
 	if err != nil {
-		return fmt.Errorf("failed to create GitHub client: %w", err)
+		return git.RemoteRepo{}, false
 	}
+	return origin, true
+}
 
-	classifier := git.NewClassifier(gitClient, githubClient, cfg.BaseBranches)
+// confirm asks a yes/no question on stderr and reads the answer from stdin.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
 
-	ctx := context.Background()
-	model := ui.NewModel(ctx, classifier)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
 
-	p := tea.NewProgram(model, tea.WithAltScreen())
-	_, err = p.Run()
-	return err
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
 }
 
 func handleVersionCommand(cmd *cobra.Command) {
@@ -106,7 +247,7 @@ func handleVersionCommand(cmd *cobra.Command) {
 
 func main() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
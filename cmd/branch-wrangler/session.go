@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dfinster/branch-wrangler/internal/config"
+	"github.com/dfinster/branch-wrangler/internal/git"
+	"github.com/dfinster/branch-wrangler/internal/github"
+	"github.com/dfinster/branch-wrangler/internal/ui"
+)
+
+// session holds everything needed to classify the branches of the
+// repository in the current directory.
+type session struct {
+	cfg        *config.Config
+	git        *git.Client
+	github     *github.CachedClient
+	classifier *git.Classifier
+	host       string
+	owner      string
+	repo       string
+}
+
+// newSession locates the repository and authenticates with GitHub using
+// cfg. When interactive is true, logins run in the TUI and an
+// invalid token prompts for a fresh login; otherwise the device flow
+// prints to stderr and an invalid token is an error.
+func newSession(ctx context.Context, cmd *cobra.Command, cfg *config.Config, interactive bool) (*session, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	gitClient := git.NewClient(cwd)
+	if !gitClient.IsGitRepo() {
+		return nil, fmt.Errorf("not a git repository")
+	}
+
+	gitClient.SetHostAliases(cfg.HostAliases)
+	origin, err := gitClient.ResolveRemote("origin")
+	if err != nil {
+		return nil, fmt.Errorf("not a GitHub repository: %w", err)
+	}
+	owner, repo := origin.Owner, origin.Name
+
+	host := resolveHost(cmd, cfg, origin.Host)
+	auth := newAuthConfig(cmd, cfg, host)
+	if interactive {
+		if _, err := auth.GetToken(); errors.Is(err, github.ErrNoToken) {
+			if _, err := ui.RunLogin(ctx, auth); err != nil {
+				return nil, fmt.Errorf("GitHub login failed: %w", err)
+			}
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	cacheOpts, err := newCacheOptions(cmd, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	githubClient, err := github.NewCachedClient(auth, owner, repo, cacheOpts)
+	var invalidToken *github.InvalidTokenError
+	if interactive && errors.As(err, &invalidToken) {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		if !confirm("Log in to GitHub again now?") {
+			return nil, err
+		}
+		auth.Token = ""
+		if _, err := ui.RunLogin(ctx, auth); err != nil {
+			return nil, fmt.Errorf("GitHub login failed: %w", err)
+		}
+		githubClient, err = github.NewCachedClient(auth, owner, repo, cacheOpts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitHub client: %w", err)
+	}
+
+	// In a fork workflow, pull requests target the parent repository: the
+	// upstream remote if there is one, or what GitHub says origin was
+	// forked from.
+	if upstream, err := gitClient.ResolveRemote("upstream"); err == nil && upstream.Host == origin.Host && upstream != origin {
+		githubClient.SetRepo(upstream.Owner, upstream.Name)
+	} else if _, err := githubClient.UseParentRepo(ctx); err != nil && !interactive {
+		fmt.Fprintf(os.Stderr, "Warning: failed to look up the parent of %s/%s: %v\n", owner, repo, err)
+	}
+	owner, repo = githubClient.Repo()
+
+	if !interactive {
+		if missing := githubClient.TokenInfo().MissingSummary(); missing != "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", missing)
+		}
+	}
+
+	// Per-repository bases are keyed by the repository pull requests go
+	// to; --base-branches overrides both.
+	bases := cfg.BaseBranchesFor(owner, repo)
+	if cmd.Flags().Changed("base-branches") {
+		bases = cfg.BaseBranches
+	}
+	classifier := git.NewClassifier(gitClient, githubClient, bases)
+	classifier.SetConcurrency(cfg.Concurrency)
+	classifier.SetStaleAfter(cfg.StaleAfter)
+
+	return &session{
+		cfg:        cfg,
+		git:        gitClient,
+		github:     githubClient,
+		classifier: classifier,
+		host:       host,
+		owner:      owner,
+		repo:       repo,
+	}, nil
+}
+
+// newCacheOptions configures the on-disk response cache from the config
+// file and --no-cache.
+func newCacheOptions(cmd *cobra.Command, cfg *config.Config) (github.CacheOptions, error) {
+	dir, err := config.GetCacheDir()
+	if err != nil {
+		return github.CacheOptions{}, fmt.Errorf("failed to locate cache directory: %w", err)
+	}
+
+	noCache, _ := cmd.Flags().GetBool("no-cache")
+	return github.CacheOptions{
+		Dir:      dir,
+		TTL:      cfg.CacheTTL,
+		Disabled: noCache,
+	}, nil
+}
@@ -1,17 +1,75 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
+// DefaultHost is the GitHub host used when neither the config file nor the
+// repository's remote names another one.
+const DefaultHost = "github.com"
+
 type Config struct {
 	GitHubTokenPath string            `yaml:"github_token_path"`
-	Token           string            `yaml:"token"`
+	Token           string            `yaml:"token,omitempty"`
 	SavedFilterSets []FilterSet       `yaml:"saved_filter_sets"`
 	BaseBranches    []string          `yaml:"base_branches"`
 	Theme           string            `yaml:"theme"`
-	KeyBindings     map[string]string `yaml:"key_bindings"`
+	KeyBindings     map[string]string `yaml:"key_bindings,omitempty"`
+	// UseGHCLIToken and UseGitCredentials let users opt out of reusing
+	// credentials from the gh CLI and git credential helpers.
+	UseGHCLIToken     bool `yaml:"use_gh_cli_token"`
+	UseGitCredentials bool `yaml:"use_git_credentials"`
+	// Concurrency caps how many branches are classified in parallel.
+	Concurrency int `yaml:"concurrency"`
+	// CacheTTL is how long GitHub answers are reused before asking again.
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+	// Host is the GitHub host to talk to. Empty means the host of the
+	// origin remote.
+	Host string `yaml:"host,omitempty"`
+	// Hosts holds per-host settings for GitHub Enterprise Server. The
+	// github.com token stays in Token.
+	Hosts map[string]HostConfig `yaml:"hosts,omitempty"`
+	// HostAliases maps SSH host aliases used in remote URLs, such as
+	// github-work, to the GitHub host they stand for. Aliases with a
+	// HostName in ~/.ssh/config are resolved without this.
+	HostAliases map[string]string `yaml:"host_aliases,omitempty"`
+	// StaleAfter is how long a branch can go without commits before it is
+	// flagged stale-by-age. Zero turns the flag off.
+	StaleAfter time.Duration `yaml:"stale_after"`
+	// Repos holds per-repository settings keyed by "owner/repo".
+	Repos map[string]RepoConfig `yaml:"repos,omitempty"`
+
+	// path and doc remember where the config came from and its original
+	// YAML tree, so Save can write back without dropping unknown keys or
+	// comments.
+	path string
+	doc  *yaml.Node
+}
+
+// HostConfig holds the credentials for one GitHub Enterprise Server host.
+type HostConfig struct {
+	Token string `yaml:"token,omitempty"`
+	// ClientID is the OAuth app used for device-flow logins. Each
+	// Enterprise Server needs its own app.
+	ClientID string `yaml:"client_id,omitempty"`
+}
+
+// RepoConfig holds settings for one repository.
+type RepoConfig struct {
+	// BaseBranches replaces the global base_branches for this repository.
+	// Entries may be glob patterns such as release/*.
+	BaseBranches []string `yaml:"base_branches,omitempty"`
 }
 
 type FilterSet struct {
@@ -21,10 +79,14 @@ type FilterSet struct {
 
 func DefaultConfig() *Config {
 	return &Config{
-		GitHubTokenPath: "~/.github-token",
-		BaseBranches:    []string{"main", "master", "develop"},
-		Theme:           "default",
-		KeyBindings:     make(map[string]string),
+		GitHubTokenPath:   "~/.github-token",
+		Theme:             "default",
+		KeyBindings:       make(map[string]string),
+		UseGHCLIToken:     true,
+		UseGitCredentials: true,
+		Concurrency:       5,
+		CacheTTL:          15 * time.Minute,
+		StaleAfter:        90 * 24 * time.Hour,
 		SavedFilterSets: []FilterSet{
 			{
 				Name:   "Stale branches",
@@ -56,10 +118,525 @@ func GetConfigPath() (string, error) {
 	return filepath.Join(appConfigDir, "config.yml"), nil
 }
 
-func Load() (*Config, error) {
-	return DefaultConfig(), nil
+// BaseBranchesFor returns the base branches for owner/repo: its own list
+// from repos if it has one, else base_branches. Either may be empty, in
+// which case the default branch is discovered.
+func (c *Config) BaseBranchesFor(owner, repo string) []string {
+	for key, rc := range c.Repos {
+		if strings.EqualFold(key, owner+"/"+repo) && len(rc.BaseBranches) > 0 {
+			return rc.BaseBranches
+		}
+	}
+	return c.BaseBranches
+}
+
+// GetCacheDir returns the directory for cached GitHub responses,
+// honoring XDG_CACHE_HOME.
+func GetCacheDir() (string, error) {
+	cacheDir := os.Getenv("XDG_CACHE_HOME")
+	if cacheDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		cacheDir = filepath.Join(homeDir, ".cache")
+	}
+
+	return filepath.Join(cacheDir, "branch-wrangler"), nil
+}
+
+// GetStateDir returns the directory for state worth keeping across runs,
+// such as the undo log, honoring XDG_STATE_HOME. Unlike the cache
+// directory, clearing it loses information.
+func GetStateDir() (string, error) {
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		stateDir = filepath.Join(homeDir, ".local", "state")
+	}
+
+	return filepath.Join(stateDir, "branch-wrangler"), nil
+}
+
+// ExpandHome replaces a leading ~ in path with the user's home directory.
+func ExpandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, strings.TrimPrefix(path, "~")), nil
 }
 
+// Load reads the config file at path, or at GetConfigPath when path is
+// empty, and merges it over DefaultConfig. A missing file is not an error.
+func Load(path string) (*Config, error) {
+	if path == "" {
+		var err error
+		path, err = GetConfigPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.path = path
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return cfg, nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		// A file of only comments, like the one config edit creates, parses
+		// to nothing; keep the comments so saving does not drop them.
+		doc = yaml.Node{Kind: yaml.DocumentNode, HeadComment: string(bytes.TrimSpace(data)), Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+
+	if err := doc.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	cfg.doc = &doc
+
+	return cfg, nil
+}
+
+// Path returns the file the config was loaded from and will be saved to.
+func (c *Config) Path() string {
+	return c.path
+}
+
+// Save writes the config back to its file. Keys from the original file
+// that Config does not know about, and all comments, are preserved.
+// Settings the file does not mention are only written when they differ
+// from DefaultConfig, so later changes to the defaults still apply.
 func (c *Config) Save() error {
+	if c.path == "" {
+		path, err := GetConfigPath()
+		if err != nil {
+			return err
+		}
+		c.path = path
+	}
+
+	var updated yaml.Node
+	if err := updated.Encode(c); err != nil {
+		return err
+	}
+
+	doc := c.doc
+	if doc == nil || len(doc.Content) == 0 {
+		doc = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: top level is not a mapping", c.path)
+	}
+	if err := dropDefaults(&updated, root); err != nil {
+		return err
+	}
+	mergeMapping(root, &updated, dropOmitted(c))
+	c.dropStaleHosts(root)
+
+	var buf bytes.Buffer
+	if len(root.Content) == 0 {
+		// With nothing set, write back just the comments rather than an
+		// empty {} mapping, so the file config edit creates is unchanged.
+		if doc.HeadComment != "" {
+			buf.WriteString(doc.HeadComment + "\n")
+		}
+	} else {
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+		if err := enc.Close(); err != nil {
+			return err
+		}
+	}
+
+	if err := writeFileAtomic(c.path, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	c.doc = doc
+
+	return nil
+}
+
+// SetToken replaces the active token. The previous token, if any, is kept
+// in the file as a versioned comment above the token: key.
+func (c *Config) SetToken(token string) {
+	if c.Token != "" && c.Token != token {
+		c.keepTokenHistory(c.tokenKey(), c.Token)
+	}
+	c.Token = token
+}
+
+// keepTokenHistory adds old as the next versioned comment above key,
+// after any history already there.
+func (c *Config) keepTokenHistory(key *yaml.Node, old string) {
+	line := fmt.Sprintf("# token_v%d: %s", nextTokenVersion(c.doc), old)
+	key.HeadComment = joinComments(key.HeadComment, line)
+}
+
+// ClearToken removes the active token. Token history comments are kept.
+func (c *Config) ClearToken() {
+	c.Token = ""
+}
+
+// HostToken returns the token stored for host.
+func (c *Config) HostToken(host string) string {
+	if IsDefaultHost(host) {
+		return c.Token
+	}
+	return c.Hosts[host].Token
+}
+
+// SetHostToken replaces the token for host, keeping the previous one as a
+// versioned comment like SetToken does.
+func (c *Config) SetHostToken(host, token string) {
+	if IsDefaultHost(host) {
+		c.SetToken(token)
+		return
+	}
+
+	hostConfig := c.Hosts[host]
+	if hostConfig.Token != "" && hostConfig.Token != token {
+		c.keepTokenHistory(c.hostTokenKey(host), hostConfig.Token)
+	}
+
+	hostConfig.Token = token
+	if c.Hosts == nil {
+		c.Hosts = make(map[string]HostConfig)
+	}
+	c.Hosts[host] = hostConfig
+}
+
+// ClearHostToken removes the token for host. The host entry stays so its
+// token history comments are kept.
+func (c *Config) ClearHostToken(host string) {
+	if IsDefaultHost(host) {
+		c.ClearToken()
+		return
+	}
+
+	if hostConfig, ok := c.Hosts[host]; ok {
+		hostConfig.Token = ""
+		c.Hosts[host] = hostConfig
+	}
+}
+
+// HostClientID returns the OAuth client ID configured for host, if any.
+func (c *Config) HostClientID(host string) string {
+	return c.Hosts[host].ClientID
+}
+
+// IsDefaultHost reports whether host is github.com rather than a GitHub
+// Enterprise Server. An empty host means github.com.
+func IsDefaultHost(host string) bool {
+	return host == "" || strings.EqualFold(host, DefaultHost)
+}
+
+// tokenKey returns the token: key node of the loaded document, adding one
+// if the file does not have it yet.
+func (c *Config) tokenKey() *yaml.Node {
+	return ensureKey(c.root(), "token", yaml.ScalarNode)
+}
+
+// hostTokenKey returns the hosts.<host>.token: key node of the loaded
+// document, adding the missing levels.
+func (c *Config) hostTokenKey(host string) *yaml.Node {
+	hosts := lookupKey(c.root(), "hosts")
+	if hosts == nil || hosts.Kind != yaml.MappingNode {
+		ensureKey(c.root(), "hosts", yaml.MappingNode)
+		hosts = lookupKey(c.root(), "hosts")
+	}
+
+	ensureKey(hosts, host, yaml.MappingNode)
+	return ensureKey(lookupKey(hosts, host), "token", yaml.ScalarNode)
+}
+
+// root returns the top-level mapping of the loaded document, creating an
+// empty document if none was loaded.
+func (c *Config) root() *yaml.Node {
+	if c.doc == nil || len(c.doc.Content) == 0 {
+		c.doc = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	return c.doc.Content[0]
+}
+
+// ensureKey returns the key node for key in mapping, appending the key
+// with an empty value of the given kind if it is missing. An existing
+// value of another kind is replaced.
+func ensureKey(mapping *yaml.Node, key string, kind yaml.Kind) *yaml.Node {
+	tag := "!!str"
+	if kind == yaml.MappingNode {
+		tag = "!!map"
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			if value := mapping.Content[i+1]; value.Kind != kind {
+				*value = yaml.Node{Kind: kind, Tag: tag}
+			}
+			return mapping.Content[i]
+		}
+	}
+
+	keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+	mapping.Content = append(mapping.Content, keyNode, &yaml.Node{Kind: kind, Tag: tag})
+	return keyNode
+}
+
+var tokenHistoryPattern = regexp.MustCompile(`#\s*token_v(\d+):`)
+
+// nextTokenVersion scans every comment in doc for token history entries
+// and returns the next free version number.
+func nextTokenVersion(doc *yaml.Node) int {
+	highest := 0
+
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n == nil {
+			return
+		}
+		for _, comment := range []string{n.HeadComment, n.LineComment, n.FootComment} {
+			for _, m := range tokenHistoryPattern.FindAllStringSubmatch(comment, -1) {
+				if v, err := strconv.Atoi(m[1]); err == nil && v > highest {
+					highest = v
+				}
+			}
+		}
+		for _, child := range n.Content {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	return highest + 1
+}
+
+// SecureDir restricts the directory holding the config file to its owner
+// when it is branch-wrangler's own config directory.
+func (c *Config) SecureDir() error {
+	defaultPath, err := GetConfigPath()
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(c.path)
+	if dir != filepath.Dir(defaultPath) && filepath.Base(dir) != "branch-wrangler" {
+		return nil
+	}
+
+	return os.Chmod(dir, 0700)
+}
+
+// dropOmitted lists known keys whose omitempty value is currently empty and
+// must therefore be removed from the file rather than left stale.
+func dropOmitted(c *Config) []string {
+	var keys []string
+	if c.Token == "" {
+		keys = append(keys, "token")
+	}
+	if len(c.KeyBindings) == 0 {
+		keys = append(keys, "key_bindings")
+	}
+	if c.Host == "" {
+		keys = append(keys, "host")
+	}
+	if len(c.Hosts) == 0 {
+		keys = append(keys, "hosts")
+	}
+	if len(c.HostAliases) == 0 {
+		keys = append(keys, "host_aliases")
+	}
+	if len(c.Repos) == 0 {
+		keys = append(keys, "repos")
+	}
+	return keys
+}
+
+// dropDefaults removes from updated the keys that still have their
+// default value and are not in the file yet, so saving a token, say, does
+// not write every default into the file and freeze it there.
+func dropDefaults(updated, existing *yaml.Node) error {
+	var defaults yaml.Node
+	if err := defaults.Encode(DefaultConfig()); err != nil {
+		return err
+	}
+
+	for i := 0; i+1 < len(updated.Content); {
+		key, value := updated.Content[i].Value, updated.Content[i+1]
+		if lookupKey(existing, key) == nil && sameYAML(value, lookupKey(&defaults, key)) {
+			updated.Content = append(updated.Content[:i], updated.Content[i+2:]...)
+			continue
+		}
+		i += 2
+	}
 	return nil
 }
+
+// sameYAML reports whether a and b serialize identically.
+func sameYAML(a, b *yaml.Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	da, errA := yaml.Marshal(a)
+	db, errB := yaml.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(da, db)
+}
+
+// dropStaleHosts removes hosts and per-host keys that are no longer set,
+// which mergeMapping alone would leave in place.
+func (c *Config) dropStaleHosts(root *yaml.Node) {
+	hosts := lookupKey(root, "hosts")
+	if hosts == nil || hosts.Kind != yaml.MappingNode {
+		return
+	}
+
+	for i := 0; i+1 < len(hosts.Content); {
+		host := hosts.Content[i].Value
+		hostConfig, ok := c.Hosts[host]
+		if !ok {
+			removeKey(hosts, host)
+			continue
+		}
+
+		if value := hosts.Content[i+1]; value.Kind == yaml.MappingNode {
+			if hostConfig.Token == "" {
+				removeKey(value, "token")
+			}
+			if hostConfig.ClientID == "" {
+				removeKey(value, "client_id")
+			}
+		}
+		i += 2
+	}
+}
+
+// mergeMapping copies every key of src into dst. Existing keys keep their
+// position and comments; new keys are appended. Keys listed in drop are
+// removed from dst.
+func mergeMapping(dst, src *yaml.Node, drop []string) {
+	for _, key := range drop {
+		removeKey(dst, key)
+	}
+
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+
+		existing := lookupKey(dst, key.Value)
+		if existing == nil {
+			dst.Content = append(dst.Content, key, value)
+			continue
+		}
+		mergeValue(existing, value)
+	}
+}
+
+func mergeValue(dst, src *yaml.Node) {
+	if dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode {
+		mergeMapping(dst, src, nil)
+		return
+	}
+
+	head, line, foot := dst.HeadComment, dst.LineComment, dst.FootComment
+	*dst = *src
+	dst.HeadComment, dst.LineComment, dst.FootComment = head, line, foot
+}
+
+func lookupKey(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// removeKey deletes key from mapping. Comments above the key move to the
+// next key, or to the end of the mapping, so history is not lost.
+func removeKey(mapping *yaml.Node, key string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != key {
+			continue
+		}
+
+		if comment := mapping.Content[i].HeadComment; comment != "" {
+			if i+2 < len(mapping.Content) {
+				next := mapping.Content[i+2]
+				next.HeadComment = joinComments(comment, next.HeadComment)
+			} else {
+				mapping.FootComment = joinComments(mapping.FootComment, comment)
+			}
+		}
+
+		mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+		return
+	}
+}
+
+func joinComments(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	return a + "\n" + b
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, so readers never observe a partially written config.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".config-*.yml")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpName, path)
+}
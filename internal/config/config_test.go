@@ -0,0 +1,411 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadMissingFileReturnsDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	want := DefaultConfig()
+	if !reflect.DeepEqual(cfg.BaseBranches, want.BaseBranches) {
+		t.Errorf("BaseBranches = %v, want %v", cfg.BaseBranches, want.BaseBranches)
+	}
+	if cfg.Path() != path {
+		t.Errorf("Path() = %q, want %q", cfg.Path(), path)
+	}
+}
+
+func TestLoadMergesOverDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := `base_branches: [trunk]
+theme: dark
+cache_ttl: 1h30m
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(cfg.BaseBranches, []string{"trunk"}) {
+		t.Errorf("BaseBranches = %v, want [trunk]", cfg.BaseBranches)
+	}
+	if cfg.Theme != "dark" {
+		t.Errorf("Theme = %q, want dark", cfg.Theme)
+	}
+	if cfg.CacheTTL != 90*time.Minute {
+		t.Errorf("CacheTTL = %v, want 1h30m", cfg.CacheTTL)
+	}
+	if cfg.GitHubTokenPath != DefaultConfig().GitHubTokenPath {
+		t.Errorf("GitHubTokenPath = %q, want default", cfg.GitHubTokenPath)
+	}
+	if len(cfg.SavedFilterSets) != len(DefaultConfig().SavedFilterSets) {
+		t.Errorf("SavedFilterSets not defaulted: %v", cfg.SavedFilterSets)
+	}
+}
+
+func TestLoadInvalidYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte("base_branches: [unterminated\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(path); err == nil {
+		t.Error("Load() expected error for invalid YAML")
+	}
+}
+
+func TestSavePreservesUnknownKeysAndComments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := `# team settings
+theme: dark # keep me
+future_option: 42
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	cfg.Theme = "light"
+	cfg.Concurrency = 8
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+
+	for _, want := range []string{"# team settings", "theme: light # keep me", "future_option: 42", "concurrency: 8"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("saved config missing %q:\n%s", want, out)
+		}
+	}
+	// Defaults the file never set stay out of it, so changes to them
+	// still reach this user.
+	for _, key := range []string{"github_token_path:", "saved_filter_sets:", "base_branches:", "use_gh_cli_token:", "cache_ttl:", "stale_after:"} {
+		if strings.Contains(out, key) {
+			t.Errorf("saved config should not write default %s\n%s", key, out)
+		}
+	}
+	if strings.Contains(out, "\ntoken:") {
+		t.Errorf("saved config should omit empty token:\n%s", out)
+	}
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("config permissions = %o, want 600", perm)
+		}
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() after Save error = %v", err)
+	}
+	if reloaded.Theme != "light" {
+		t.Errorf("reloaded Theme = %q, want light", reloaded.Theme)
+	}
+}
+
+func TestSaveKeepsCommentOnlyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte("# settings\n# concurrency: 5\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	cfg.Concurrency = 9
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# settings", "# concurrency: 5", "\nconcurrency: 9"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("saved config missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestSetTokenKeepsVersionedHistory(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := filepath.Join(t.TempDir(), "branch-wrangler")
+	path := filepath.Join(dir, "config.yml")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("theme: dark\ntoken: first\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{"second", "third"} {
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		cfg.SetToken(token)
+		if err := cfg.Save(); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		if err := cfg.SecureDir(); err != nil {
+			t.Fatalf("SecureDir() error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "theme: dark\n# token_v1: first\n# token_v2: second\ntoken: third\n"
+	if !strings.HasPrefix(string(data), want) {
+		t.Errorf("saved config = \n%s\nwant prefix\n%s", data, want)
+	}
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0700 {
+			t.Errorf("config dir permissions = %o, want 700", perm)
+		}
+	}
+}
+
+func TestClearTokenKeepsHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := "theme: dark\n# token_v1: first\ntoken: second\nfuture_option: true\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	cfg.ClearToken()
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	if strings.Contains(out, "token: second") {
+		t.Errorf("active token not removed:\n%s", out)
+	}
+	for _, want := range []string{"# token_v1: first", "future_option: true", "theme: dark"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("saved config missing %q:\n%s", want, out)
+		}
+	}
+
+	cfg, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	cfg.SetToken("third")
+	if cfg.Token != "third" {
+		t.Errorf("Token = %q, want third", cfg.Token)
+	}
+	if v := nextTokenVersion(cfg.doc); v != 2 {
+		t.Errorf("nextTokenVersion() = %d, want 2", v)
+	}
+}
+
+func TestHostTokensKeepHistoryPerHost(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := "token: dotcom\nhosts:\n  ghe.example.com:\n    client_id: Iv1.abc\n    token: first\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := cfg.HostToken("ghe.example.com"); got != "first" {
+		t.Errorf("HostToken(ghe) = %q, want first", got)
+	}
+	if got := cfg.HostToken("github.com"); got != "dotcom" {
+		t.Errorf("HostToken(github.com) = %q, want dotcom", got)
+	}
+
+	cfg.SetHostToken("ghe.example.com", "second")
+	cfg.SetHostToken("other.example.com", "new")
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := reloaded.HostToken("ghe.example.com"); got != "second" {
+		t.Errorf("reloaded HostToken(ghe) = %q, want second", got)
+	}
+	if got := reloaded.HostClientID("ghe.example.com"); got != "Iv1.abc" {
+		t.Errorf("reloaded HostClientID(ghe) = %q, want Iv1.abc", got)
+	}
+	if got := reloaded.HostToken("other.example.com"); got != "new" {
+		t.Errorf("reloaded HostToken(other) = %q, want new", got)
+	}
+	if reloaded.Token != "dotcom" {
+		t.Errorf("reloaded Token = %q, want dotcom", reloaded.Token)
+	}
+
+	reloaded.ClearHostToken("ghe.example.com")
+	if err := reloaded.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	if strings.Contains(out, "token: second") {
+		t.Errorf("cleared host token still saved:\n%s", out)
+	}
+	for _, want := range []string{"# token_v1: first", "client_id: Iv1.abc", "token: new", "token: dotcom"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("saved config missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestHostTokenRotatedTwiceKeepsBothVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := "hosts:\n  ghe.example.com:\n    # team server\n    token: first\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{"second", "third"} {
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		cfg.SetHostToken("ghe.example.com", token)
+		if err := cfg.Save(); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	for _, want := range []string{"# team server", "# token_v1: first", "# token_v2: second", "token: third"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("saved config missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "token_v1") > strings.Index(out, "token_v2") {
+		t.Errorf("token history out of order:\n%s", out)
+	}
+}
+
+func TestBaseBranchesForRepo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := `base_branches: [main]
+repos:
+  Octo/Service:
+    base_branches: [develop, "release/*"]
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if got := cfg.BaseBranchesFor("octo", "service"); !reflect.DeepEqual(got, []string{"develop", "release/*"}) {
+		t.Errorf("BaseBranchesFor(octo/service) = %v, want [develop release/*]", got)
+	}
+	if got := cfg.BaseBranchesFor("octo", "other"); !reflect.DeepEqual(got, []string{"main"}) {
+		t.Errorf("BaseBranchesFor(octo/other) = %v, want [main]", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := `concurrency: 0
+base_branches: ["release/[", main]
+saved_filter_sets:
+  - name: Mine
+    filter: [OPEN_PR]
+  - name: mine
+    filter: []
+repos:
+  just-a-name:
+    base_branches: [main]
+hosts:
+  github.com:
+    token: ghp_ignored
+theem: dark
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	var got []string
+	for _, err := range cfg.Validate() {
+		key, _, _ := strings.Cut(err.Error(), ":")
+		got = append(got, key)
+	}
+	sort.Strings(got)
+	want := []string{"base_branches", "concurrency", "hosts.github.com.token", "repos", "saved_filter_sets[1]", "saved_filter_sets[1]"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Validate() keys = %v, want %v", got, want)
+	}
+
+	if got := cfg.UnknownKeys(); !reflect.DeepEqual(got, []string{"theem"}) {
+		t.Errorf("UnknownKeys() = %v, want [theem]", got)
+	}
+
+	if errs := DefaultConfig().Validate(); len(errs) != 0 {
+		t.Errorf("DefaultConfig().Validate() = %v, want none", errs)
+	}
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Validate reports settings that are present but cannot work. Saved filter
+// set entries are not checked here, since state IDs belong to the git
+// package.
+func (c *Config) Validate() []error {
+	var errs []error
+	if c.Concurrency < 1 {
+		errs = append(errs, fmt.Errorf("concurrency: must be at least 1, got %d", c.Concurrency))
+	}
+	if c.CacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("cache_ttl: must not be negative, got %s", c.CacheTTL))
+	}
+	if c.StaleAfter < 0 {
+		errs = append(errs, fmt.Errorf("stale_after: must not be negative, got %s", c.StaleAfter))
+	}
+
+	errs = append(errs, checkPatterns("base_branches", c.BaseBranches)...)
+	for key, rc := range c.Repos {
+		if owner, repo, ok := strings.Cut(key, "/"); !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+			errs = append(errs, fmt.Errorf("repos: key %q is not owner/repo", key))
+		}
+		errs = append(errs, checkPatterns("repos."+key+".base_branches", rc.BaseBranches)...)
+	}
+
+	seen := make(map[string]bool)
+	for i, set := range c.SavedFilterSets {
+		name := strings.ToLower(set.Name)
+		switch {
+		case set.Name == "":
+			errs = append(errs, fmt.Errorf("saved_filter_sets[%d]: name is empty", i))
+		case seen[name]:
+			errs = append(errs, fmt.Errorf("saved_filter_sets[%d]: name %q is used more than once", i, set.Name))
+		}
+		seen[name] = true
+		if len(set.Filter) == 0 {
+			errs = append(errs, fmt.Errorf("saved_filter_sets[%d]: filter is empty", i))
+		}
+	}
+
+	for host, hc := range c.Hosts {
+		if IsDefaultHost(host) && hc.Token != "" {
+			errs = append(errs, fmt.Errorf("hosts.%s.token: ignored; the %s token goes in the top-level token: key", host, DefaultHost))
+		}
+	}
+
+	return errs
+}
+
+func checkPatterns(key string, patterns []string) []error {
+	var errs []error
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid pattern %q: %w", key, p, err))
+		}
+	}
+	return errs
+}
+
+// UnknownKeys lists top-level keys in the file that Config does not
+// define. Save keeps them, so they are not errors, but they are often
+// typos.
+func (c *Config) UnknownKeys() []string {
+	if c.doc == nil || len(c.doc.Content) == 0 || c.doc.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+
+	known := make(map[string]bool)
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name != "" {
+			known[name] = true
+		}
+	}
+
+	var unknown []string
+	root := c.doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if key := root.Content[i].Value; !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	return unknown
+}
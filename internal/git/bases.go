@@ -0,0 +1,141 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"strings"
+)
+
+// DefaultRemote is the remote whose branches base branches are compared
+// against.
+const DefaultRemote = "origin"
+
+// fallbackBaseBranches are tried when neither the config nor discovery
+// names a base branch.
+var fallbackBaseBranches = []string{"main", "master", "develop"}
+
+// BaseRef is a base branch and the ref merged work is compared against.
+type BaseRef struct {
+	// Name is the branch name, such as main or release/1.2.
+	Name string `json:"name"`
+	// Ref is the remote-tracking ref, such as origin/main, unless the
+	// local branch has commits the remote lacks.
+	Ref string `json:"ref"`
+}
+
+// DefaultBranch returns the branch remote's HEAD points at, as recorded
+// by clone or `git remote set-head`, or "" if it is not known.
+func (c *Client) DefaultBranch(remote string) string {
+	ref, err := c.output("symbolic-ref", "--quiet", "--short", "refs/remotes/"+remote+"/HEAD")
+	if err != nil {
+		return ""
+	}
+	name, ok := strings.CutPrefix(ref, remote+"/")
+	if !ok {
+		return ""
+	}
+	return name
+}
+
+// ResolveBaseBranches expands base branch names and glob patterns such as
+// release/* against the local branches and those of remote, skipping names
+// that exist in neither. Each base is compared through its remote-tracking
+// ref so a stale local copy does not hide merged work, unless the local
+// branch is ahead of it.
+func (c *Client) ResolveBaseBranches(remote string, patterns []string) ([]BaseRef, error) {
+	local, err := c.refNames("refs/heads/")
+	if err != nil {
+		return nil, err
+	}
+	remoteNames, err := c.refNames("refs/remotes/" + remote + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	localSet := make(map[string]bool, len(local))
+	for _, name := range local {
+		localSet[name] = true
+	}
+	remoteSet := make(map[string]bool, len(remoteNames))
+	for _, name := range remoteNames {
+		if name != "HEAD" {
+			remoteSet[name] = true
+		}
+	}
+
+	var names []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			if localSet[pattern] || remoteSet[pattern] {
+				add(pattern)
+			}
+			continue
+		}
+		for _, name := range append(remoteNames, local...) {
+			if ok, _ := path.Match(pattern, name); ok && (localSet[name] || remoteSet[name]) {
+				add(name)
+			}
+		}
+	}
+
+	bases := make([]BaseRef, 0, len(names))
+	for _, name := range names {
+		ref := name
+		if remoteSet[name] {
+			ref = remote + "/" + name
+			if localSet[name] && !c.isAncestor(name, ref) {
+				ref = name
+			}
+		}
+		bases = append(bases, BaseRef{Name: name, Ref: ref})
+	}
+	return bases, nil
+}
+
+// resolveCommits maps each of refs to the commit it points at, or returns
+// nil when any of them cannot be resolved.
+func (c *Client) resolveCommits(refs []string) map[string]string {
+	if len(refs) == 0 {
+		return nil
+	}
+	args := []string{"rev-parse"}
+	for _, ref := range refs {
+		args = append(args, ref+"^{commit}")
+	}
+	output, err := c.output(args...)
+	if err != nil {
+		return nil
+	}
+	commits := strings.Split(output, "\n")
+	if len(commits) != len(refs) {
+		return nil
+	}
+	result := make(map[string]string, len(refs))
+	for i, ref := range refs {
+		result[ref] = commits[i]
+	}
+	return result
+}
+
+// refNames lists the refs under prefix with the prefix removed.
+func (c *Client) refNames(prefix string) ([]string, error) {
+	out, err := c.outputBytes("for-each-ref", "--format=%(refname)", prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		names = append(names, strings.TrimPrefix(scanner.Text(), prefix))
+	}
+	return names, scanner.Err()
+}
@@ -0,0 +1,69 @@
+package git
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestResolveBaseBranches(t *testing.T) {
+	dir := newTestRepo(t, 0)
+	tree := runGit(t, dir, "", "rev-parse", "main^{tree}")
+	base := runGit(t, dir, "", "rev-parse", "main")
+	newer := runGit(t, dir, "", "commit-tree", tree, "-p", base, "-m", "newer")
+
+	// origin/main moved on; the local main is stale. The local develop
+	// has a commit origin/develop lacks.
+	runGit(t, dir, "", "update-ref", "refs/remotes/origin/main", newer)
+	runGit(t, dir, "", "update-ref", "refs/remotes/origin/develop", base)
+	runGit(t, dir, "", "update-ref", "refs/heads/develop", newer)
+	runGit(t, dir, "", "update-ref", "refs/remotes/origin/release/1.0", base)
+	runGit(t, dir, "", "update-ref", "refs/heads/release/2.0", base)
+	runGit(t, dir, "", "update-ref", "refs/remotes/origin/feature/x", base)
+	runGit(t, dir, "", "symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/main")
+
+	client := NewClient(dir)
+	if got := client.DefaultBranch("origin"); got != "main" {
+		t.Errorf("DefaultBranch() = %q, want main", got)
+	}
+
+	got, err := client.ResolveBaseBranches("origin", []string{"main", "develop", "missing", "release/*", "main"})
+	if err != nil {
+		t.Fatalf("ResolveBaseBranches() error = %v", err)
+	}
+	want := []BaseRef{
+		{Name: "main", Ref: "origin/main"},
+		{Name: "develop", Ref: "develop"},
+		{Name: "release/1.0", Ref: "origin/release/1.0"},
+		{Name: "release/2.0", Ref: "release/2.0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveBaseBranches() = %+v, want %+v", got, want)
+	}
+}
+
+func TestClassifierDiscoversDefaultBranch(t *testing.T) {
+	dir := newTestRepo(t, 1)
+	runGit(t, dir, "", "branch", "-m", "main", "trunk")
+	runGit(t, dir, "", "update-ref", "refs/remotes/origin/trunk", "trunk")
+	runGit(t, dir, "", "update-ref", "-d", "refs/remotes/origin/main")
+
+	// Without origin/HEAD, GitHub's metadata names the default branch.
+	fake := &fakeGitHub{defaultBranch: "trunk"}
+	classifier := NewClassifier(NewClient(dir), fake, nil)
+	if got := classifier.DefaultBranch(context.Background()); got != "trunk" {
+		t.Errorf("DefaultBranch() = %q, want trunk", got)
+	}
+
+	runGit(t, dir, "", "update-ref", "refs/heads/topic-000", "trunk")
+	runGit(t, dir, "", "update-ref", "refs/remotes/origin/topic-000", "trunk")
+	branches, err := classifier.ClassifyAllBranches(context.Background())
+	if err != nil {
+		t.Fatalf("ClassifyAllBranches() error = %v", err)
+	}
+	for _, b := range branches {
+		if b.Name == "topic-000" && (b.State != FullyMergedBase || b.MergedInto != "origin/trunk") {
+			t.Errorf("topic-000 = %s merged into %q, want %s merged into origin/trunk", b.State, b.MergedInto, FullyMergedBase)
+		}
+	}
+}
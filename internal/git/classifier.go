@@ -3,71 +3,324 @@ package git
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
 
 	"github.com/dfinster/branch-wrangler/internal/github"
 )
 
+// DefaultConcurrency caps how many branches are classified at once, which
+// also bounds in-flight GitHub API calls.
+const DefaultConcurrency = 5
+
+// DefaultStaleAfter is how long a branch can go without commits before it
+// is flagged stale-by-age.
+const DefaultStaleAfter = 90 * 24 * time.Hour
+
+// GitHubClient is the subset of github.CachedClient the classifier uses.
+type GitHubClient interface {
+	PrefetchBranches(ctx context.Context, heads []github.Head) error
+	GetPullRequestsForBranch(ctx context.Context, head github.Head) ([]github.PullRequest, error)
+	BranchExists(ctx context.Context, head github.Head) (bool, error)
+	LookupBranch(ctx context.Context, head github.Head, commit string) (github.BranchStatus, error)
+	DefaultBranch(ctx context.Context) (string, error)
+	SaveCache() error
+}
+
 type Classifier struct {
 	gitClient    *Client
-	githubClient *github.CachedClient
+	githubClient GitHubClient
 	baseBranches []string
+	concurrency  int
+	staleAfter   time.Duration
+	now          func() time.Time
+
+	// remotes caches the repository each remote points at; nil means the
+	// remote is not a GitHub repository.
+	remotesMu sync.Mutex
+	remotes   map[string]*RemoteRepo
+
+	// bases are baseBranches plus the discovered default branch, resolved
+	// to refs; nil until first needed.
+	basesMu       sync.Mutex
+	bases         []BaseRef
+	defaultBranch string
+	// merged holds, per base ref, the branches whose tips it contains.
+	merged map[string]map[string]bool
+	// baseCommits holds the commit each base ref pointed at when resolved.
+	baseCommits map[string]string
 }
 
-func NewClassifier(gitClient *Client, githubClient *github.CachedClient, baseBranches []string) *Classifier {
+func NewClassifier(gitClient *Client, githubClient GitHubClient, baseBranches []string) *Classifier {
 	return &Classifier{
 		gitClient:    gitClient,
 		githubClient: githubClient,
 		baseBranches: baseBranches,
+		concurrency:  DefaultConcurrency,
+		staleAfter:   DefaultStaleAfter,
+		now:          time.Now,
 	}
 }
 
+// SetConcurrency sets how many branches ClassifyAllBranches works on at
+// once. Values below 1 mean 1.
+func (c *Classifier) SetConcurrency(n int) {
+	c.concurrency = max(n, 1)
+}
+
+// SetStaleAfter sets how old a branch's last commit must be for it to be
+// flagged stale-by-age. Zero or less turns the flag off.
+func (c *Classifier) SetStaleAfter(d time.Duration) {
+	c.staleAfter = d
+}
+
+// ClassifyBranch sets the branch's primary State and its Flags, and
+// records in Trace how it got there.
 func (c *Classifier) ClassifyBranch(ctx context.Context, branch *Branch) error {
-	_, isDetached, err := c.gitClient.GetCurrentBranch()
+	branch.Trace = nil
+	askedGitHub, err := c.classify(ctx, branch)
 	if err != nil {
 		return err
 	}
+	c.setFlags(ctx, branch, askedGitHub)
+	return nil
+}
 
-	if isDetached {
-		branch.State = DetachedHead
-		return nil
+// Status reports the repository-level condition: a detached HEAD or an
+// operation in progress. Branch classification does not depend on it.
+func (c *Classifier) Status() (GitStatus, error) {
+	return c.gitClient.GetStatus()
+}
+
+// DefaultBranch returns the repository's default branch, from
+// origin/HEAD or GitHub, or else the first base branch that exists.
+func (c *Classifier) DefaultBranch(ctx context.Context) string {
+	bases := c.baseRefs(ctx)
+
+	c.basesMu.Lock()
+	defer c.basesMu.Unlock()
+	if c.defaultBranch != "" {
+		return c.defaultBranch
+	}
+	if len(bases) > 0 {
+		return bases[0].Name
+	}
+	return ""
+}
+
+// BaseBranches returns the base branches branches are compared with.
+func (c *Classifier) BaseBranches(ctx context.Context) []BaseRef {
+	return c.baseRefs(ctx)
+}
+
+// baseRefs returns the resolved base branches, resolving them on first
+// use. The default branch comes first, from refs/remotes/origin/HEAD or,
+// failing that, GitHub's repository metadata. The configured names and
+// patterns follow, or the usual names when none are configured.
+func (c *Classifier) baseRefs(ctx context.Context) []BaseRef {
+	c.basesMu.Lock()
+	defer c.basesMu.Unlock()
+	if c.bases != nil {
+		return c.bases
+	}
+
+	defaultBranch := c.gitClient.DefaultBranch(DefaultRemote)
+	if defaultBranch == "" {
+		if name, err := c.githubClient.DefaultBranch(ctx); err == nil {
+			defaultBranch = name
+		}
+	}
+
+	var patterns []string
+	if defaultBranch != "" {
+		patterns = append(patterns, defaultBranch)
+	}
+	if len(c.baseBranches) > 0 {
+		patterns = append(patterns, c.baseBranches...)
+	} else if defaultBranch == "" {
+		patterns = append(patterns, fallbackBaseBranches...)
+	}
+
+	bases, err := c.gitClient.ResolveBaseBranches(DefaultRemote, patterns)
+	if err != nil || bases == nil {
+		bases = []BaseRef{}
+	}
+
+	// Find what every base contains up front rather than asking once per
+	// branch and base; on failure mergedInto asks per branch instead.
+	refs := make([]string, len(bases))
+	for i, base := range bases {
+		refs[i] = base.Ref
+	}
+	c.merged, _ = c.gitClient.MergedBranches(refs)
+	c.baseCommits = c.gitClient.resolveCommits(refs)
+
+	c.bases = bases
+	c.defaultBranch = defaultBranch
+	return bases
+}
+
+// mergedInto reports whether the branch's tip is reachable from base.
+func (c *Classifier) mergedInto(name, base string) bool {
+	c.basesMu.Lock()
+	merged, ok := c.merged[base]
+	c.basesMu.Unlock()
+	if !ok {
+		return c.gitClient.IsMergedIntoBase(name, base)
+	}
+	return merged[name]
+}
+
+// isBase reports whether the branch is itself one of the bases, which are
+// never classified as merged into one another.
+func isBase(name string, bases []BaseRef) bool {
+	for _, base := range bases {
+		if base.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// classify sets the primary state. askedGitHub reports whether pull
+// requests were looked up, so setFlags does not repeat a failed call.
+func (c *Classifier) classify(ctx context.Context, branch *Branch) (askedGitHub bool, err error) {
+	if branch.LastCommitSHA == "" {
+		branch.trace("has commits", "git for-each-ref refs/heads/", "no", nil)
+		branch.State = NoCommits
+		return false, nil
 	}
 
 	if branch.TrackingRef == "" {
+		branch.trace("upstream configured", "branch."+branch.Name+".merge", "no", nil)
 		branch.State = NoUpstream
-		return nil
+		return false, nil
 	}
+	branch.trace("upstream configured", "branch."+branch.Name+".merge", branch.TrackingRef, nil)
 
-	if branch.CommitCount == 0 {
-		branch.State = NoCommits
-		return nil
+	bases := c.baseRefs(ctx)
+	refs := make([]string, len(bases))
+	for i, base := range bases {
+		refs[i] = base.Ref
 	}
+	branch.trace("base branches", "refs/remotes/origin/HEAD, GitHub default branch, base_branches", strings.Join(refs, ", "), nil)
 
-	remoteExists := c.gitClient.RemoteExists(branch.Name)
-	if !remoteExists && branch.TrackingRef != "" {
+	branch.trace("tracking ref exists", "git for-each-ref %(upstream:track)", yesNo(!branch.TrackingGone), nil)
+	if branch.TrackingGone {
+		// A prune after a rename on GitHub also removes the tracking ref,
+		// so only a rename is worth telling apart here.
+		if c.upstreamRenamed(ctx, branch, branch.Name) {
+			return false, nil
+		}
 		branch.State = OrphanRemoteDeleted
-		return nil
+		return false, nil
 	}
 
-	for _, base := range c.baseBranches {
-		if c.gitClient.IsMergedIntoBase(branch.Name, base) {
+	if isBase(branch.Name, bases) {
+		branch.trace("is a base branch", "", "yes, not compared with bases", nil)
+		bases = nil
+	}
+	for _, base := range bases {
+		merged := c.mergedInto(branch.Name, base.Ref)
+		branch.trace("merged into "+base.Ref, "git for-each-ref --merged="+base.Ref, yesNo(merged), nil)
+		if merged {
 			branch.State = FullyMergedBase
-			return nil
+			branch.MergedInto = base.Ref
+			branch.MergeMethod = MergedByMerge
+			return false, nil
 		}
 	}
 
-	prs, err := c.githubClient.GetPullRequestsForBranch(ctx, branch.Name)
+	head, ok := c.headFor(branch)
+	if !ok {
+		branch.trace("pushes to GitHub", "remote URL", "no, skipping GitHub", nil)
+		return false, c.classifyWithoutPR(ctx, branch)
+	}
+
+	prs, err := c.githubClient.GetPullRequestsForBranch(ctx, head)
 	if err != nil {
-		return c.classifyByGitStatus(branch)
+		branch.trace("pull requests", "GitHub: pull requests from "+head.String(), "unavailable, using git only", err)
+		return true, c.classifyWithoutPR(ctx, branch)
 	}
+	branch.trace("pull requests", "GitHub: pull requests from "+head.String(), fmt.Sprintf("%d found", len(prs)), nil)
 
 	if len(prs) > 0 {
-		return c.classifyByPR(ctx, branch, prs[0])
+		return true, c.classifyByPR(ctx, branch, head, prs[0])
+	}
+
+	// The tracking ref is still here; ask GitHub whether the branch is.
+	exists, err := c.githubClient.BranchExists(ctx, head)
+	if err != nil {
+		branch.trace("branch on GitHub", "GitHub: branch "+head.String(), "unavailable, assuming yes from tracking ref", err)
+		return true, c.classifyByGitStatus(branch)
 	}
+	branch.trace("branch on GitHub", "GitHub: branch "+head.String(), yesNo(exists), nil)
 
+	// A branch still on GitHub without a pull request is taken to be in
+	// progress. Only one deleted there may have been merged some other
+	// way, so only then is the git history searched for it.
+	if !exists {
+		if c.absorbedIntoBase(ctx, branch) {
+			return true, nil
+		}
+		if c.upstreamRenamedOrGone(ctx, branch, branch.TrackingRef) {
+			return true, nil
+		}
+	}
+
+	return true, c.classifyByGitStatus(branch)
+}
+
+// classifyWithoutPR classifies a branch when GitHub could not be asked
+// about its pull requests, because it does not push to GitHub or the
+// lookup failed. A branch squash-merged or rebased onto a base is still
+// found from git history alone.
+func (c *Classifier) classifyWithoutPR(ctx context.Context, branch *Branch) error {
+	if c.absorbedIntoBase(ctx, branch) {
+		return nil
+	}
 	return c.classifyByGitStatus(branch)
 }
 
+// absorbedIntoBase marks the branch FullyMergedBase when its changes
+// reached a base branch through a squash or rebase merge.
+func (c *Classifier) absorbedIntoBase(ctx context.Context, branch *Branch) bool {
+	bases := c.baseRefs(ctx)
+	if isBase(branch.Name, bases) {
+		return false
+	}
+	for _, base := range bases {
+		// Passing the resolved commit spares resolving the base again.
+		c.basesMu.Lock()
+		rev, resolved := c.baseCommits[base.Ref]
+		c.basesMu.Unlock()
+		if !resolved {
+			rev = base.Ref
+		}
+		commit, method, ok := c.gitClient.FindAbsorbingCommit(branch.Name, rev)
+		result := "no"
+		if ok {
+			result = fmt.Sprintf("yes, %s %.12s", method, commit)
+		}
+		branch.trace("squash or rebase merged into "+base.Ref, "git patch-id, git merge-tree", result, nil)
+		if ok {
+			branch.State = FullyMergedBase
+			branch.MergedInto = base.Ref
+			branch.MergedBy = commit
+			branch.MergeMethod = method
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Classifier) classifyByGitStatus(branch *Branch) error {
+	branch.trace("ahead/behind upstream", "git for-each-ref %(upstream:track)",
+		fmt.Sprintf("%d ahead, %d behind", branch.Ahead, branch.Behind), nil)
+
 	if branch.Ahead == 0 && branch.Behind == 0 {
 		branch.State = InSync
 		return nil
@@ -84,7 +337,13 @@ func (c *Classifier) classifyByGitStatus(branch *Branch) error {
 	}
 
 	if branch.Ahead > 0 && branch.Behind > 0 {
-		branch.State = Diverged
+		rewritten := c.gitClient.UpstreamRewritten(branch.Name, branch.TrackingRef)
+		branch.trace("upstream rewritten", "git merge-base, reflog of "+branch.TrackingRef, yesNo(rewritten), nil)
+		if rewritten {
+			branch.State = UpstreamChanged
+		} else {
+			branch.State = Diverged
+		}
 		return nil
 	}
 
@@ -92,10 +351,11 @@ func (c *Classifier) classifyByGitStatus(branch *Branch) error {
 	return nil
 }
 
-func (c *Classifier) classifyByPR(ctx context.Context, branch *Branch, pr github.PullRequest) error {
+func (c *Classifier) classifyByPR(ctx context.Context, branch *Branch, head github.Head, pr github.PullRequest) error {
 	branch.PRNumber = pr.Number
 	branch.PRTitle = pr.Title
 	branch.PRURL = pr.URL
+	branch.trace("pull request state", fmt.Sprintf("GitHub: PR #%d", pr.Number), prStateName(pr), nil)
 
 	if pr.State == "open" {
 		if pr.Draft {
@@ -108,9 +368,18 @@ func (c *Classifier) classifyByPR(ctx context.Context, branch *Branch, pr github
 
 	if pr.State == "closed" {
 		if pr.Merged {
-			remoteExists, err := c.githubClient.BranchExists(ctx, branch.Name)
-			if err != nil {
-				return err
+			// When GitHub cannot say, fall back to the remote-tracking ref
+			// checked above rather than failing the whole scan.
+			remoteExists, err := c.githubClient.BranchExists(ctx, head)
+			switch {
+			case github.IsRateLimited(err):
+				branch.trace("branch on GitHub", "GitHub: branch "+head.String(), "rate limited, assuming yes from tracking ref", err)
+				remoteExists = true
+			case err != nil:
+				branch.trace("branch on GitHub", "GitHub: branch "+head.String(), "unavailable, assuming yes from tracking ref", err)
+				remoteExists = true
+			default:
+				branch.trace("branch on GitHub", "GitHub: branch "+head.String(), yesNo(remoteExists), nil)
 			}
 
 			if remoteExists {
@@ -118,7 +387,12 @@ func (c *Classifier) classifyByPR(ctx context.Context, branch *Branch, pr github
 			} else {
 				branch.State = StaleLocal
 			}
-		} else {
+			return nil
+		}
+
+		// A closed pull request may have been merged by hand or through
+		// another one.
+		if !c.absorbedIntoBase(ctx, branch) {
 			branch.State = ClosedPR
 		}
 		return nil
@@ -127,17 +401,243 @@ func (c *Classifier) classifyByPR(ctx context.Context, branch *Branch, pr github
 	return c.classifyByGitStatus(branch)
 }
 
+// setFlags records every condition that holds for the branch, including
+// those State does not show because an earlier check won. Lookups repeat
+// only what classify skipped, and GitHub answers mostly come from the
+// prefetched cache.
+func (c *Classifier) setFlags(ctx context.Context, branch *Branch, askedGitHub bool) {
+	if !askedGitHub && branch.TrackingRef != "" {
+		if head, ok := c.headFor(branch); ok {
+			prs, err := c.githubClient.GetPullRequestsForBranch(ctx, head)
+			if err != nil {
+				branch.trace("flag has-pr", "GitHub: pull requests from "+head.String(), "unavailable", err)
+			} else if len(prs) > 0 {
+				branch.PRNumber = prs[0].Number
+				branch.PRTitle = prs[0].Title
+				branch.PRURL = prs[0].URL
+			}
+		}
+	}
+
+	if bases := c.baseRefs(ctx); branch.MergedInto == "" && !isBase(branch.Name, bases) {
+		for _, base := range bases {
+			if c.mergedInto(branch.Name, base.Ref) {
+				branch.MergedInto = base.Ref
+				branch.MergeMethod = MergedByMerge
+				break
+			}
+		}
+	}
+
+	upstreamMissing := false
+	switch branch.State {
+	case OrphanRemoteDeleted, UpstreamGone, RemoteRenamed, StaleLocal:
+		upstreamMissing = true
+	}
+
+	set := map[BranchFlag]bool{
+		FlagAhead:           branch.Ahead > 0,
+		FlagBehind:          branch.Behind > 0,
+		FlagDiverged:        branch.Ahead > 0 && branch.Behind > 0,
+		FlagHasPR:           branch.PRNumber > 0,
+		FlagMergedIntoBase:  branch.MergedInto != "",
+		FlagUpstreamMissing: upstreamMissing,
+		FlagStaleByAge:      c.staleAfter > 0 && !branch.LastCommit.IsZero() && c.now().Sub(branch.LastCommit) > c.staleAfter,
+	}
+
+	branch.Flags = nil
+	var names []string
+	for _, flag := range AllFlags {
+		if set[flag] {
+			branch.Flags = append(branch.Flags, flag)
+			names = append(names, string(flag))
+		}
+	}
+	branch.trace("flags", "", strings.Join(names, ", "), nil)
+}
+
+// upstreamRenamedOrGone asks GitHub about the branch's upstream, using
+// commit to find pull requests that followed a rename. It sets
+// RemoteRenamed or UpstreamGone and returns true when GitHub gave a
+// definite answer that the upstream is no longer there under its name.
+func (c *Classifier) upstreamRenamedOrGone(ctx context.Context, branch *Branch, commit string) bool {
+	status, source, ok := c.lookupUpstream(ctx, branch, "renamed or deleted on GitHub", commit)
+	if !ok {
+		return false
+	}
+
+	switch {
+	case status.RenamedTo != "":
+		branch.trace("renamed or deleted on GitHub", source, "renamed to "+status.RenamedTo, nil)
+		branch.State = RemoteRenamed
+		branch.RenamedTo = status.RenamedTo
+	case !status.Exists:
+		branch.trace("renamed or deleted on GitHub", source, "deleted", nil)
+		branch.State = UpstreamGone
+	default:
+		branch.trace("renamed or deleted on GitHub", source, "exists", nil)
+		return false
+	}
+	return true
+}
+
+// upstreamRenamed asks GitHub whether the branch's upstream was renamed,
+// and if so sets RemoteRenamed and returns true.
+func (c *Classifier) upstreamRenamed(ctx context.Context, branch *Branch, commit string) bool {
+	status, source, ok := c.lookupUpstream(ctx, branch, "renamed on GitHub", commit)
+	if !ok {
+		return false
+	}
+
+	if status.RenamedTo == "" {
+		branch.trace("renamed on GitHub", source, "no", nil)
+		return false
+	}
+	branch.trace("renamed on GitHub", source, "renamed to "+status.RenamedTo, nil)
+	branch.State = RemoteRenamed
+	branch.RenamedTo = status.RenamedTo
+	return true
+}
+
+// lookupUpstream asks GitHub what became of the branch's upstream. ok is
+// false when it could not be asked, which is traced under rule. Branches
+// that push somewhere other than their upstream are left alone, since the
+// pull request head says nothing about the upstream.
+func (c *Classifier) lookupUpstream(ctx context.Context, branch *Branch, rule, commit string) (status github.BranchStatus, source string, ok bool) {
+	if branch.PushRemote != "" && branch.PushRemote != branch.UpstreamRemote {
+		return github.BranchStatus{}, "", false
+	}
+
+	head, ok := c.headFor(branch)
+	if !ok {
+		return github.BranchStatus{}, "", false
+	}
+
+	source = "GitHub: branch " + head.String() + ", following renames"
+	status, err := c.githubClient.LookupBranch(ctx, head, c.gitClient.commitOf(commit))
+	if err != nil {
+		branch.trace(rule, source, "unavailable", err)
+		return github.BranchStatus{}, source, false
+	}
+	return status, source, true
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func prStateName(pr github.PullRequest) string {
+	switch {
+	case pr.Merged:
+		return "merged"
+	case pr.Draft && pr.State == "open":
+		return "draft"
+	default:
+		return pr.State
+	}
+}
+
+// headFor returns where pull requests for branch come from: the branch on
+// its push remote, which in a fork workflow is the fork. ok is false when
+// the branch does not push to a GitHub repository.
+func (c *Classifier) headFor(branch *Branch) (github.Head, bool) {
+	remote := branch.PushRemote
+	if remote == "" {
+		remote = branch.UpstreamRemote
+	}
+	if remote == "" || remote == "." {
+		return github.Head{}, false
+	}
+
+	repo := c.resolveRemote(remote)
+	if repo == nil {
+		return github.Head{}, false
+	}
+
+	name := branch.Name
+	if ref, ok := strings.CutPrefix(branch.PushRef, remote+"/"); ok {
+		name = ref
+	} else if remote == branch.UpstreamRemote && branch.UpstreamBranch != "" {
+		name = branch.UpstreamBranch
+	}
+
+	return github.Head{Owner: repo.Owner, Repo: repo.Name, Branch: name}, true
+}
+
+func (c *Classifier) resolveRemote(remote string) *RemoteRepo {
+	c.remotesMu.Lock()
+	defer c.remotesMu.Unlock()
+
+	if repo, ok := c.remotes[remote]; ok {
+		return repo
+	}
+	if c.remotes == nil {
+		c.remotes = make(map[string]*RemoteRepo)
+	}
+
+	var result *RemoteRepo
+	if repo, err := c.gitClient.ResolveRemote(remote); err == nil {
+		result = &repo
+	}
+	c.remotes[remote] = result
+	return result
+}
+
 func (c *Classifier) ClassifyAllBranches(ctx context.Context) ([]Branch, error) {
 	branches, err := c.gitClient.ListBranches()
 	if err != nil {
 		return nil, fmt.Errorf("failed to list branches: %w", err)
 	}
 
+	// Bases can move between scans; resolve them afresh.
+	c.basesMu.Lock()
+	c.bases = nil
+	c.basesMu.Unlock()
+
+	var tracked []github.Head
 	for i := range branches {
-		if err := c.ClassifyBranch(ctx, &branches[i]); err != nil {
-			return nil, fmt.Errorf("failed to classify branch %s: %w", branches[i].Name, err)
+		if branches[i].TrackingRef == "" {
+			continue
+		}
+		if head, ok := c.headFor(&branches[i]); ok {
+			tracked = append(tracked, head)
 		}
 	}
+	// A failed prefetch is not fatal: ClassifyBranch falls back to
+	// per-branch REST lookups for anything not cached.
+	prefetchErr := c.githubClient.PrefetchBranches(ctx, tracked)
+
+	// Each worker writes only to its own element, so results keep the
+	// order ListBranches returned.
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(c.concurrency)
+	for i := range branches {
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			branch := &branches[i]
+			if err := c.ClassifyBranch(gctx, branch); err != nil {
+				return fmt.Errorf("failed to classify branch %s: %w", branch.Name, err)
+			}
+			if prefetchErr != nil && branch.TrackingRef != "" {
+				step := TraceStep{Rule: "batched GitHub lookup", Source: "GitHub GraphQL", Result: "failed, asked per branch", Err: prefetchErr.Error()}
+				branch.Trace = append([]TraceStep{step}, branch.Trace...)
+			}
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	// The cache only saves API calls on the next run; failing to write it
+	// does not affect this one.
+	_ = c.githubClient.SaveCache()
 
 	return branches, nil
 }
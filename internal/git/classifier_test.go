@@ -0,0 +1,568 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dfinster/branch-wrangler/internal/github"
+)
+
+// fakeGitHub answers every lookup from memory and counts calls.
+type fakeGitHub struct {
+	prs     map[string][]github.PullRequest
+	gone    map[string]bool
+	renames map[string]string
+	prErr   error
+	// branchErrs fails BranchExists for these branches.
+	branchErrs map[string]error
+
+	defaultBranch string
+	latency       time.Duration
+	// batchLatency is charged per 50 heads prefetched, like the GraphQL
+	// batches of the real client.
+	batchLatency time.Duration
+	inFlight     atomic.Int32
+	maxSeen      atomic.Int32
+
+	mu    sync.Mutex
+	heads map[string]github.Head
+}
+
+func (f *fakeGitHub) PrefetchBranches(ctx context.Context, heads []github.Head) error {
+	for start := 0; start < len(heads); start += 50 {
+		time.Sleep(f.batchLatency)
+	}
+	return nil
+}
+
+func (f *fakeGitHub) GetPullRequestsForBranch(ctx context.Context, head github.Head) ([]github.PullRequest, error) {
+	f.mu.Lock()
+	if f.heads == nil {
+		f.heads = make(map[string]github.Head)
+	}
+	f.heads[head.Branch] = head
+	f.mu.Unlock()
+
+	n := f.inFlight.Add(1)
+	defer f.inFlight.Add(-1)
+	for {
+		seen := f.maxSeen.Load()
+		if n <= seen || f.maxSeen.CompareAndSwap(seen, n) {
+			break
+		}
+	}
+
+	if f.latency > 0 {
+		time.Sleep(f.latency)
+	}
+	if f.prErr != nil {
+		return nil, f.prErr
+	}
+	return f.prs[head.Branch], nil
+}
+
+func (f *fakeGitHub) BranchExists(ctx context.Context, head github.Head) (bool, error) {
+	if err := f.branchErrs[head.Branch]; err != nil {
+		return false, err
+	}
+	return !f.gone[head.Branch], nil
+}
+
+func (f *fakeGitHub) LookupBranch(ctx context.Context, head github.Head, commit string) (github.BranchStatus, error) {
+	if name, ok := f.renames[head.Branch]; ok {
+		return github.BranchStatus{Exists: true, RenamedTo: name}, nil
+	}
+	return github.BranchStatus{Exists: !f.gone[head.Branch]}, nil
+}
+
+func (f *fakeGitHub) DefaultBranch(ctx context.Context) (string, error) {
+	return f.defaultBranch, nil
+}
+
+func (f *fakeGitHub) SaveCache() error {
+	return nil
+}
+
+// runGit runs git in dir with a fixed identity and fails the test on error.
+func runGit(tb testing.TB, dir string, stdin string, args ...string) string {
+	tb.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+	)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		tb.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// newTestRepo creates a repository with a main branch and n topic
+// branches, each with one commit adding a file of its own and an origin
+// tracking ref. The commits are written with a single fast-import and the
+// tracking config in bulk, so hundreds of branches take well under a
+// second to set up.
+func newTestRepo(tb testing.TB, n int) string {
+	tb.Helper()
+
+	dir := tb.TempDir()
+	runGit(tb, dir, "", "init", "-q", "-b", "main")
+	runGit(tb, dir, "", "commit", "-q", "--allow-empty", "-m", "initial")
+	base := runGit(tb, dir, "", "rev-parse", "HEAD")
+
+	var stream, config strings.Builder
+	fmt.Fprintf(&stream, "reset refs/remotes/origin/main\nfrom %s\n\n", base)
+	now := time.Now().Unix()
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("topic-%03d", i)
+		content := fmt.Sprintf("%s\nchanges made on %s\n", name, name)
+		fmt.Fprintf(&stream, "commit refs/heads/%s\nmark :%d\ncommitter Test <test@example.com> %d +0000\ndata %d\n%s\nfrom %s\nM 100644 inline %s.txt\ndata %d\n%s\n",
+			name, i+1, now, len(name), name, base, name, len(content), content)
+		fmt.Fprintf(&stream, "reset refs/remotes/origin/%s\nfrom :%d\n\n", name, i+1)
+		fmt.Fprintf(&config, "[branch %q]\n\tremote = origin\n\tmerge = refs/heads/%s\n", name, name)
+	}
+	runGit(tb, dir, stream.String(), "fast-import", "--quiet")
+
+	f, err := os.OpenFile(filepath.Join(dir, ".git", "config"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "[remote \"origin\"]\n\turl = https://github.com/octo/repo.git\n\tfetch = +refs/heads/*:refs/remotes/origin/*\n%s", config.String())
+
+	return dir
+}
+
+// squashIntoMain adds one commit per branch to main and origin/main with
+// the changes newTestRepo made on it, as a squash merge would.
+func squashIntoMain(tb testing.TB, dir string, names ...string) {
+	tb.Helper()
+
+	var stream strings.Builder
+	now := time.Now().Unix()
+	for i, name := range names {
+		content := fmt.Sprintf("%s\nchanges made on %s\n", name, name)
+		message := "Squashed " + name
+		fmt.Fprintf(&stream, "commit refs/heads/main\ncommitter Test <test@example.com> %d +0000\ndata %d\n%s\n", now, len(message), message)
+		if i == 0 {
+			stream.WriteString("from refs/heads/main^0\n")
+		}
+		fmt.Fprintf(&stream, "M 100644 inline %s.txt\ndata %d\n%s\n", name, len(content), content)
+	}
+	stream.WriteString("reset refs/remotes/origin/main\nfrom refs/heads/main\n\n")
+	runGit(tb, dir, stream.String(), "fast-import", "--quiet", "--force")
+}
+
+func TestClassifyAllBranchesKeepsOrderAndBoundsConcurrency(t *testing.T) {
+	dir := newTestRepo(t, 20)
+
+	fake := &fakeGitHub{
+		prs: map[string][]github.PullRequest{
+			"topic-003": {{Number: 3, State: "open"}},
+		},
+		latency: 5 * time.Millisecond,
+	}
+
+	classifier := NewClassifier(NewClient(dir), fake, []string{"main"})
+	classifier.SetConcurrency(3)
+
+	branches, err := classifier.ClassifyAllBranches(context.Background())
+	if err != nil {
+		t.Fatalf("ClassifyAllBranches() error = %v", err)
+	}
+
+	if len(branches) != 21 {
+		t.Fatalf("got %d branches, want 21", len(branches))
+	}
+	if branches[0].Name != "main" {
+		t.Errorf("branches[0] = %s, want main", branches[0].Name)
+	}
+	for i := 1; i < len(branches); i++ {
+		if want := fmt.Sprintf("topic-%03d", i-1); branches[i].Name != want {
+			t.Errorf("branches[%d] = %s, want %s", i, branches[i].Name, want)
+		}
+	}
+
+	if branches[4].State != OpenPR {
+		t.Errorf("topic-003 state = %s, want %s", branches[4].State, OpenPR)
+	}
+	if branches[5].State != InSync {
+		t.Errorf("topic-004 state = %s, want %s", branches[5].State, InSync)
+	}
+
+	if got := fake.maxSeen.Load(); got > 3 {
+		t.Errorf("max concurrent API calls = %d, want <= 3", got)
+	}
+}
+
+func TestClassifyAllBranchesHonorsCancellation(t *testing.T) {
+	dir := newTestRepo(t, 5)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	classifier := NewClassifier(NewClient(dir), &fakeGitHub{}, []string{"main"})
+	if _, err := classifier.ClassifyAllBranches(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ClassifyAllBranches() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestClassifyAllBranchesFollowsForkRemotes(t *testing.T) {
+	dir := newTestRepo(t, 2)
+	runGit(t, dir, "", "remote", "add", "fork", "git@github.com:me/repo-fork.git")
+	runGit(t, dir, "", "remote", "add", "upstream", "https://github.com/octo/repo.git")
+	runGit(t, dir, "", "config", "branch.topic-000.pushRemote", "fork")
+	runGit(t, dir, "", "update-ref", "refs/remotes/fork/topic-000", "topic-000")
+
+	// topic-001 tracks upstream, where origin has no copy of it.
+	runGit(t, dir, "", "config", "branch.topic-001.remote", "upstream")
+	runGit(t, dir, "", "update-ref", "refs/remotes/upstream/topic-001", "topic-001")
+	runGit(t, dir, "", "update-ref", "-d", "refs/remotes/origin/topic-001")
+
+	fake := &fakeGitHub{
+		prs: map[string][]github.PullRequest{
+			"topic-000": {{Number: 12, State: "open"}},
+		},
+	}
+
+	classifier := NewClassifier(NewClient(dir), fake, []string{"main"})
+	branches, err := classifier.ClassifyAllBranches(context.Background())
+	if err != nil {
+		t.Fatalf("ClassifyAllBranches() error = %v", err)
+	}
+
+	byName := map[string]Branch{}
+	for _, b := range branches {
+		byName[b.Name] = b
+	}
+
+	forked := byName["topic-000"]
+	if forked.State != OpenPR {
+		t.Errorf("topic-000 state = %s, want %s", forked.State, OpenPR)
+	}
+	if forked.UpstreamRemote != "origin" || forked.PushRemote != "fork" || forked.PushRef != "fork/topic-000" {
+		t.Errorf("topic-000 remotes = %q, %q, %q; want origin, fork, fork/topic-000", forked.UpstreamRemote, forked.PushRemote, forked.PushRef)
+	}
+	if want := (github.Head{Owner: "me", Repo: "repo-fork", Branch: "topic-000"}); fake.heads["topic-000"] != want {
+		t.Errorf("topic-000 looked up as %+v, want %+v", fake.heads["topic-000"], want)
+	}
+
+	if upstream := byName["topic-001"]; upstream.State != InSync || upstream.TrackingRef != "upstream/topic-001" {
+		t.Errorf("topic-001 = %s tracking %s, want %s tracking upstream/topic-001", upstream.State, upstream.TrackingRef, InSync)
+	}
+	if want := (github.Head{Owner: "octo", Repo: "repo", Branch: "topic-001"}); fake.heads["topic-001"] != want {
+		t.Errorf("topic-001 looked up as %+v, want %+v", fake.heads["topic-001"], want)
+	}
+}
+
+func TestClassifyAllBranchesDetectsUpstreamChanges(t *testing.T) {
+	dir := newTestRepo(t, 7)
+	base := runGit(t, dir, "", "rev-parse", "main")
+	tree := runGit(t, dir, "", "rev-parse", "main^{tree}")
+
+	// commitOn makes a commit on top of parents without touching HEAD.
+	commitOn := func(message string, parents ...string) string {
+		args := []string{"commit-tree", tree, "-m", message}
+		for _, p := range parents {
+			args = append(args, "-p", p)
+		}
+		return runGit(t, dir, "", args...)
+	}
+
+	// topic-002 was force-pushed after a local commit on top of it.
+	runGit(t, dir, "", "update-ref", "refs/heads/topic-002", commitOn("local", "topic-002"))
+	runGit(t, dir, "", "update-ref", "refs/remotes/origin/topic-002", commitOn("rewritten", base))
+
+	// topic-003's upstream was replaced by unrelated history.
+	runGit(t, dir, "", "update-ref", "refs/remotes/origin/topic-003", commitOn("unrelated"))
+
+	// topic-004 diverged the ordinary way.
+	runGit(t, dir, "", "update-ref", "refs/remotes/origin/topic-004", commitOn("remote", "topic-004"))
+	runGit(t, dir, "", "update-ref", "refs/heads/topic-004", commitOn("local", "topic-004"))
+
+	// topic-005 was renamed on GitHub and then pruned locally.
+	runGit(t, dir, "", "update-ref", "-d", "refs/remotes/origin/topic-005")
+
+	// topic-006 was deleted on GitHub and then pruned locally.
+	runGit(t, dir, "", "update-ref", "-d", "refs/remotes/origin/topic-006")
+
+	fake := &fakeGitHub{
+		gone:    map[string]bool{"topic-000": true, "topic-001": true, "topic-005": true, "topic-006": true},
+		renames: map[string]string{"topic-000": "feature/renamed", "topic-005": "feature/other"},
+	}
+
+	classifier := NewClassifier(NewClient(dir), fake, []string{"main"})
+	branches, err := classifier.ClassifyAllBranches(context.Background())
+	if err != nil {
+		t.Fatalf("ClassifyAllBranches() error = %v", err)
+	}
+
+	want := map[string]BranchState{
+		"topic-000": RemoteRenamed,
+		"topic-001": UpstreamGone,
+		"topic-002": UpstreamChanged,
+		"topic-003": UpstreamChanged,
+		"topic-004": Diverged,
+		"topic-005": RemoteRenamed,
+		"topic-006": OrphanRemoteDeleted,
+	}
+	for _, b := range branches {
+		if state, ok := want[b.Name]; ok && b.State != state {
+			t.Errorf("%s state = %s, want %s", b.Name, b.State, state)
+		}
+		if b.Name == "topic-000" && b.RenamedTo != "feature/renamed" {
+			t.Errorf("topic-000 RenamedTo = %q, want feature/renamed", b.RenamedTo)
+		}
+		if b.Name == "topic-006" {
+			// Only whether it was renamed is decided, so the trace must
+			// not claim a state the branch did not get.
+			for _, step := range b.Trace {
+				if step.Result == "deleted" {
+					t.Errorf("topic-006 trace says %q: %s, but its state is %s", step.Rule, step.Result, b.State)
+				}
+			}
+		}
+	}
+}
+
+func TestClassifyAllBranchesSetsFlagsBeyondState(t *testing.T) {
+	dir := newTestRepo(t, 3)
+	tree := runGit(t, dir, "", "rev-parse", "main^{tree}")
+
+	// topic-000 has an open PR and is both ahead of and behind its remote.
+	remote := runGit(t, dir, "", "commit-tree", tree, "-p", "topic-000", "-m", "remote")
+	local := runGit(t, dir, "", "commit-tree", tree, "-p", "topic-000", "-m", "local")
+	runGit(t, dir, "", "update-ref", "refs/remotes/origin/topic-000", remote)
+	runGit(t, dir, "", "update-ref", "refs/heads/topic-000", local)
+
+	// topic-001 was merged into main and has a merged PR.
+	runGit(t, dir, "", "update-ref", "refs/heads/main", "topic-001")
+
+	fake := &fakeGitHub{
+		prs: map[string][]github.PullRequest{
+			"topic-000": {{Number: 1, State: "open"}},
+			"topic-001": {{Number: 2, State: "closed", Merged: true}},
+		},
+	}
+
+	classifier := NewClassifier(NewClient(dir), fake, []string{"main"})
+	classifier.SetStaleAfter(time.Hour)
+	classifier.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	branches, err := classifier.ClassifyAllBranches(context.Background())
+	if err != nil {
+		t.Fatalf("ClassifyAllBranches() error = %v", err)
+	}
+
+	want := map[string]struct {
+		state BranchState
+		flags []BranchFlag
+	}{
+		"topic-000": {OpenPR, []BranchFlag{FlagAhead, FlagBehind, FlagDiverged, FlagHasPR, FlagStaleByAge}},
+		"topic-001": {FullyMergedBase, []BranchFlag{FlagHasPR, FlagMergedIntoBase, FlagStaleByAge}},
+		"topic-002": {InSync, []BranchFlag{FlagStaleByAge}},
+	}
+	for _, b := range branches {
+		w, ok := want[b.Name]
+		if !ok {
+			continue
+		}
+		if b.State != w.state || !reflect.DeepEqual(b.Flags, w.flags) {
+			t.Errorf("%s = %s %v, want %s %v", b.Name, b.State, b.Flags, w.state, w.flags)
+		}
+	}
+}
+
+func TestClassifyBranchTracesSwallowedErrors(t *testing.T) {
+	dir := newTestRepo(t, 1)
+	fake := &fakeGitHub{prErr: errors.New("connection refused")}
+
+	branches, err := NewClassifier(NewClient(dir), fake, []string{"main"}).ClassifyAllBranches(context.Background())
+	if err != nil {
+		t.Fatalf("ClassifyAllBranches() error = %v", err)
+	}
+
+	topic := branches[1]
+	if topic.State != InSync {
+		t.Fatalf("topic-000 state = %s, want %s", topic.State, InSync)
+	}
+
+	var rules []string
+	var swallowed string
+	for _, step := range topic.Trace {
+		rules = append(rules, step.Rule)
+		if step.Err != "" {
+			swallowed = step.Err
+		}
+	}
+	want := []string{
+		"upstream configured",
+		"base branches",
+		"tracking ref exists",
+		"merged into origin/main",
+		"pull requests",
+		"squash or rebase merged into origin/main",
+		"ahead/behind upstream",
+		"flags",
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("trace rules = %q, want %q", rules, want)
+	}
+	if swallowed != "connection refused" {
+		t.Errorf("swallowed error = %q, want connection refused", swallowed)
+	}
+	if out := FormatTrace(topic); !strings.Contains(out, "ignored error: connection refused") || !strings.HasSuffix(out, "=> IN_SYNC (In Sync with Remote)\n") {
+		t.Errorf("FormatTrace() =\n%s", out)
+	}
+}
+
+func TestClassifyAllBranchesSurvivesBranchLookupErrors(t *testing.T) {
+	dir := newTestRepo(t, 3)
+
+	fake := &fakeGitHub{
+		prs: map[string][]github.PullRequest{
+			"topic-000": {{Number: 1, State: "closed", Merged: true}},
+			"topic-001": {{Number: 2, State: "closed", Merged: true}},
+		},
+		branchErrs: map[string]error{
+			"topic-000": errors.New("502 Bad Gateway"),
+			"topic-002": errors.New("502 Bad Gateway"),
+		},
+	}
+
+	branches, err := NewClassifier(NewClient(dir), fake, []string{"main"}).ClassifyAllBranches(context.Background())
+	if err != nil {
+		t.Fatalf("ClassifyAllBranches() error = %v", err)
+	}
+
+	want := map[string]BranchState{
+		"topic-000": MergedRemoteExists,
+		"topic-001": MergedRemoteExists,
+		"topic-002": InSync,
+	}
+	for _, b := range branches {
+		state, ok := want[b.Name]
+		if !ok {
+			continue
+		}
+		if b.State != state {
+			t.Errorf("%s state = %s, want %s", b.Name, b.State, state)
+		}
+		if _, failed := fake.branchErrs[b.Name]; failed && !strings.Contains(FormatTrace(b), "ignored error: 502 Bad Gateway") {
+			t.Errorf("%s trace does not record the lookup error:\n%s", b.Name, FormatTrace(b))
+		}
+	}
+}
+
+func TestClassifyAllBranchesSearchesHistoryOnlyForCandidates(t *testing.T) {
+	dir := newTestRepo(t, 4)
+	squashIntoMain(t, dir, "topic-000", "topic-001", "topic-002", "topic-003")
+
+	fake := &fakeGitHub{
+		prs: map[string][]github.PullRequest{
+			"topic-002": {{Number: 2, State: "closed"}},
+			"topic-003": {{Number: 3, State: "open"}},
+		},
+		gone: map[string]bool{"topic-001": true},
+	}
+
+	branches, err := NewClassifier(NewClient(dir), fake, []string{"main"}).ClassifyAllBranches(context.Background())
+	if err != nil {
+		t.Fatalf("ClassifyAllBranches() error = %v", err)
+	}
+
+	want := map[string]struct {
+		state    BranchState
+		searched bool
+	}{
+		// Still on GitHub without a pull request, so taken to be in progress.
+		"topic-000": {InSync, false},
+		"topic-001": {FullyMergedBase, true},
+		"topic-002": {FullyMergedBase, true},
+		"topic-003": {OpenPR, false},
+	}
+	for _, b := range branches {
+		w, ok := want[b.Name]
+		if !ok {
+			continue
+		}
+		searched := false
+		for _, step := range b.Trace {
+			searched = searched || strings.HasPrefix(step.Rule, "squash or rebase merged")
+		}
+		if b.State != w.state || searched != w.searched {
+			t.Errorf("%s = %s, history searched %v; want %s, %v", b.Name, b.State, searched, w.state, w.searched)
+		}
+		if w.state == FullyMergedBase && b.MergeMethod != MergedBySquash {
+			t.Errorf("%s MergeMethod = %q, want %q", b.Name, b.MergeMethod, MergedBySquash)
+		}
+	}
+}
+
+// BenchmarkClassifyAllBranches measures a full scan of 200 branches, the
+// size the requirements' 2s target is set for. Every branch changes a
+// file, a quarter were squash-merged into main, and GitHub reports a mix
+// of closed, merged and missing pull requests and deleted branches, so
+// the git-only merge detection runs where it would in a real scan. The
+// fake charges one round trip per batched lookup, as the GraphQL prefetch
+// makes. The time per scan is reported as s/scan.
+func BenchmarkClassifyAllBranches(b *testing.B) {
+	const n = 200
+	dir := newTestRepo(b, n)
+
+	var squashed []string
+	fake := &fakeGitHub{
+		prs:          map[string][]github.PullRequest{},
+		gone:         map[string]bool{},
+		batchLatency: 150 * time.Millisecond,
+	}
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("topic-%03d", i)
+		switch i % 4 {
+		case 0:
+			squashed = append(squashed, name)
+			fake.prs[name] = []github.PullRequest{{Number: i + 1, State: "closed"}}
+		case 1:
+			fake.gone[name] = true
+		case 2:
+			fake.prs[name] = []github.PullRequest{{Number: i + 1, State: "closed", Merged: true}}
+		}
+	}
+	squashIntoMain(b, dir, squashed...)
+
+	classifier := NewClassifier(NewClient(dir), fake, []string{"main", "master", "develop"})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		branches, err := classifier.ClassifyAllBranches(context.Background())
+		if err != nil {
+			b.Fatal(err)
+		}
+		if got := branches[1]; got.State != FullyMergedBase || got.MergeMethod != MergedBySquash {
+			b.Fatalf("%s = %s merged by %q, want %s merged by %s", got.Name, got.State, got.MergeMethod, FullyMergedBase, MergedBySquash)
+		}
+	}
+	b.StopTimer()
+
+	// Reported rather than asserted, since wall-clock time depends on the
+	// machine; compare it with the 2s target by hand.
+	b.ReportMetric(b.Elapsed().Seconds()/float64(b.N), "s/scan")
+}
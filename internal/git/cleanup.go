@@ -0,0 +1,130 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// Deletion is a branch the cleanup plan deletes or leaves alone, and why.
+type Deletion struct {
+	Branch  string      `json:"branch"`
+	State   BranchState `json:"state"`
+	Commit  string      `json:"commit,omitempty"`
+	Reason  string      `json:"reason"`
+	Command string      `json:"command,omitempty"`
+}
+
+// CleanupPlan lists the branches a cleanup deletes and those in the same
+// states it skips because deleting them is never safe.
+type CleanupPlan struct {
+	Delete  []Deletion `json:"delete"`
+	Skipped []Deletion `json:"skipped"`
+}
+
+// PlanCleanup picks the branches in one of states to delete with
+// git branch -d. The current branch, base branches and branches checked
+// out in any worktree are skipped whatever their state.
+func PlanCleanup(branches []Branch, states []BranchState, bases []BaseRef, checkedOut map[string]string) CleanupPlan {
+	plan := CleanupPlan{Delete: []Deletion{}, Skipped: []Deletion{}}
+	for _, branch := range branches {
+		if !containsState(states, branch.State) {
+			continue
+		}
+
+		d := Deletion{Branch: branch.Name, State: branch.State, Commit: branch.LastCommitSHA}
+		switch path, ok := checkedOut[branch.Name]; {
+		case branch.IsCurrent:
+			d.Reason = "current branch"
+		case isBase(branch.Name, bases):
+			d.Reason = "base branch"
+		case ok:
+			d.Reason = "checked out in worktree " + path
+		}
+		if d.Reason != "" {
+			plan.Skipped = append(plan.Skipped, d)
+			continue
+		}
+
+		d.Reason = deletionReason(branch)
+		d.Command = "git branch -d " + shellQuote(branch.Name)
+		plan.Delete = append(plan.Delete, d)
+	}
+	return plan
+}
+
+func containsState(states []BranchState, state BranchState) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// deletionReason explains in a few words why the branch is safe to delete.
+func deletionReason(branch Branch) string {
+	switch {
+	case branch.State == StaleLocal && branch.PRNumber > 0:
+		return fmt.Sprintf("PR #%d merged and its branch deleted", branch.PRNumber)
+	case branch.State == StaleLocal:
+		return "merged and its remote branch deleted"
+	case branch.MergeMethod != "" && branch.MergeMethod != MergedByMerge:
+		return fmt.Sprintf("merged into %s (%s)", branch.MergedInto, branch.MergeMethod)
+	case branch.MergedInto != "":
+		return "merged into " + branch.MergedInto
+	default:
+		return branch.State.DisplayName()
+	}
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9._/@%+=:,-]+$`)
+
+// shellQuote quotes s for a POSIX shell when it needs it.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// CheckedOutBranches maps each branch checked out in a worktree of the
+// repository, including the main one, to that worktree's path.
+func (c *Client) CheckedOutBranches() (map[string]string, error) {
+	output, err := c.outputBytes("worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worktrees: %w", err)
+	}
+
+	result := make(map[string]string)
+	var path string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if p, ok := strings.CutPrefix(line, "worktree "); ok {
+			path = p
+		} else if ref, ok := strings.CutPrefix(line, "branch refs/heads/"); ok {
+			result[ref] = path
+		}
+	}
+	return result, scanner.Err()
+}
+
+// DeleteBranch runs git branch -d, which refuses to delete a branch that
+// is not merged into its upstream or HEAD. The error carries git's message.
+func (c *Client) DeleteBranch(name string) error {
+	cmd := exec.Command("git", "branch", "-d", name)
+	cmd.Dir = c.workingDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return errors.New(msg)
+		}
+		return fmt.Errorf("failed to delete branch %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package git
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPlanCleanup(t *testing.T) {
+	branches := []Branch{
+		{Name: "gone", State: StaleLocal, PRNumber: 4, LastCommitSHA: "abc"},
+		{Name: "current", State: StaleLocal, IsCurrent: true},
+		{Name: "main", State: StaleLocal},
+		{Name: "elsewhere", State: StaleLocal},
+		{Name: "squashed", State: FullyMergedBase, MergedInto: "origin/main", MergeMethod: MergedBySquash},
+		{Name: "odd name's", State: StaleLocal},
+		{Name: "open", State: OpenPR},
+	}
+	bases := []BaseRef{{Name: "main", Ref: "origin/main"}}
+	checkedOut := map[string]string{"elsewhere": "/work/other"}
+
+	plan := PlanCleanup(branches, []BranchState{StaleLocal}, bases, checkedOut)
+	wantDelete := []Deletion{
+		{Branch: "gone", State: StaleLocal, Commit: "abc", Reason: "PR #4 merged and its branch deleted", Command: "git branch -d gone"},
+		{Branch: "odd name's", State: StaleLocal, Reason: "merged and its remote branch deleted", Command: `git branch -d 'odd name'\''s'`},
+	}
+	wantSkipped := []Deletion{
+		{Branch: "current", State: StaleLocal, Reason: "current branch"},
+		{Branch: "main", State: StaleLocal, Reason: "base branch"},
+		{Branch: "elsewhere", State: StaleLocal, Reason: "checked out in worktree /work/other"},
+	}
+	if !reflect.DeepEqual(plan.Delete, wantDelete) {
+		t.Errorf("PlanCleanup() Delete = %+v, want %+v", plan.Delete, wantDelete)
+	}
+	if !reflect.DeepEqual(plan.Skipped, wantSkipped) {
+		t.Errorf("PlanCleanup() Skipped = %+v, want %+v", plan.Skipped, wantSkipped)
+	}
+
+	plan = PlanCleanup(branches, []BranchState{FullyMergedBase}, bases, checkedOut)
+	want := []Deletion{{Branch: "squashed", State: FullyMergedBase, Reason: "merged into origin/main (squash)", Command: "git branch -d squashed"}}
+	if !reflect.DeepEqual(plan.Delete, want) {
+		t.Errorf("PlanCleanup() with merged = %+v, want %+v", plan.Delete, want)
+	}
+}
+
+func TestCheckedOutBranches(t *testing.T) {
+	dir := newTestRepo(t, 2)
+	other := filepath.Join(t.TempDir(), "other")
+	runGit(t, dir, "", "worktree", "add", "-q", other, "topic-001")
+
+	got, err := NewClient(dir).CheckedOutBranches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["main"] == "" || got["topic-001"] == "" || got["topic-001"] == got["main"] {
+		t.Errorf("CheckedOutBranches() = %v, want main and topic-001 in different worktrees", got)
+	}
+	if _, ok := got["topic-000"]; ok {
+		t.Errorf("CheckedOutBranches() = %v, want no topic-000", got)
+	}
+}
+
+func TestDeleteBranchReportsGitsReason(t *testing.T) {
+	dir := newTestRepo(t, 1)
+	c := NewClient(dir)
+
+	err := c.DeleteBranch("main")
+	if err == nil {
+		t.Fatal("DeleteBranch(current) = nil, want an error")
+	}
+	if err := c.DeleteBranch("topic-000"); err != nil {
+		t.Errorf("DeleteBranch(topic-000) = %v, want nil (merged into its upstream)", err)
+	}
+	if got := runGit(t, dir, "", "branch", "--list", "topic-000"); got != "" {
+		t.Errorf("topic-000 still exists: %q", got)
+	}
+}
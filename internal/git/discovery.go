@@ -0,0 +1,261 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// branchFormat is the for-each-ref format ListBranches reads. Fields are
+// NUL-separated since author names may contain anything else. Git before
+// 2.16 has no remotename and remoteref atoms, so modern false leaves
+// those fields empty to be filled from git config instead.
+func branchFormat(modern bool) string {
+	upstreamRemote, upstreamRef, pushRemote, pushRef := "", "", "", ""
+	if modern {
+		upstreamRemote, upstreamRef = "%(upstream:remotename)", "%(upstream:remoteref)"
+		pushRemote, pushRef = "%(push:remotename)", "%(push:short)"
+	}
+	return strings.Join([]string{
+		"%(refname:short)",
+		"%(objectname)",
+		"%(committerdate:unix)",
+		"%(authorname)",
+		"%(upstream:short)",
+		"%(HEAD)",
+		upstreamRemote,
+		upstreamRef,
+		pushRemote,
+		pushRef,
+		"%(upstream:track)",
+	}, "%00")
+}
+
+const branchFields = 11
+
+// ListBranches lists local branches with their tip, upstream and
+// ahead/behind counts from a single for-each-ref, plus one git config on
+// git older than 2.16. The current branch is included even before its
+// first commit, with no LastCommitSHA.
+func (c *Client) ListBranches() ([]Branch, error) {
+	modern := c.gitVersion().atLeast(2, 16)
+	output, err := c.outputBytes("for-each-ref", "--format="+branchFormat(modern), "refs/heads/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list branches: %w", err)
+	}
+
+	var settings map[string]branchSettings
+	var pushDefault string
+	if !modern {
+		settings, pushDefault = c.branchConfig()
+	}
+
+	var branches []Branch
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), "\x00")
+		if len(parts) < branchFields {
+			continue
+		}
+
+		name := parts[0]
+		if !modern {
+			// Mirror what the missing atoms report.
+			set := settings[name]
+			if parts[4] != "" {
+				parts[6], parts[7] = set.remote, set.merge
+			}
+			parts[8] = cmp.Or(set.pushRemote, pushDefault, set.remote)
+		}
+		var commitDate time.Time
+		if secs, err := strconv.ParseInt(parts[2], 10, 64); err == nil {
+			commitDate = time.Unix(secs, 0)
+		}
+
+		// With push.default=simple, %(push) is empty for triangular
+		// setups, but git still pushes to the same branch name.
+		pushRemote, pushRef := parts[8], parts[9]
+		if pushRemote != "" && pushRef == "" {
+			pushRef = pushRemote + "/" + name
+		}
+
+		branch := Branch{
+			Name:           name,
+			LastCommitSHA:  parts[1],
+			LastCommit:     commitDate,
+			Author:         parts[3],
+			TrackingRef:    parts[4],
+			IsCurrent:      parts[5] == "*",
+			UpstreamRemote: parts[6],
+			UpstreamBranch: strings.TrimPrefix(parts[7], "refs/heads/"),
+			PushRemote:     pushRemote,
+			PushRef:        pushRef,
+		}
+		if branch.TrackingRef != "" {
+			branch.Ahead, branch.Behind, branch.TrackingGone = parseTrack(parts[10])
+		}
+		branches = append(branches, branch)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// for-each-ref only sees refs that exist, and an unborn branch has
+	// none until its first commit.
+	if current, detached, _ := c.GetCurrentBranch(); !detached && current != "" {
+		found := false
+		for _, branch := range branches {
+			if branch.Name == current {
+				found = true
+				break
+			}
+		}
+		if !found {
+			branches = append(branches, Branch{Name: current, IsCurrent: true})
+		}
+	}
+
+	return branches, nil
+}
+
+// branchSettings are a branch's upstream and push settings from git
+// config.
+type branchSettings struct {
+	remote, merge, pushRemote string
+}
+
+// branchConfig reads every branch's upstream and push settings, and
+// remote.pushDefault, in one git config call. Missing settings are
+// simply absent, so errors give empty results.
+func (c *Client) branchConfig() (map[string]branchSettings, string) {
+	settings := make(map[string]branchSettings)
+	output, _ := c.outputBytes("config", "-z", "--get-regexp", `^(branch\..*\.(remote|merge|pushremote)|remote\.pushdefault)$`)
+
+	pushDefault := ""
+	for _, entry := range strings.Split(string(output), "\x00") {
+		key, value, _ := strings.Cut(entry, "\n")
+		if key == "remote.pushdefault" {
+			pushDefault = value
+			continue
+		}
+		// Branch names may contain dots, so the variable is after the last.
+		i := strings.LastIndex(key, ".")
+		if !strings.HasPrefix(key, "branch.") || i < len("branch.") {
+			continue
+		}
+		name := key[len("branch."):i]
+		set := settings[name]
+		switch key[i+1:] {
+		case "remote":
+			set.remote = value
+		case "merge":
+			set.merge = value
+		case "pushremote":
+			set.pushRemote = value
+		}
+		settings[name] = set
+	}
+	return settings, pushDefault
+}
+
+var trackPattern = regexp.MustCompile(`(ahead|behind) (\d+)`)
+
+// parseTrack reads %(upstream:track), which is empty when in sync,
+// "[gone]" when the upstream ref is missing, and otherwise like
+// "[ahead 1, behind 2]".
+func parseTrack(track string) (ahead, behind int, gone bool) {
+	if track == "[gone]" {
+		return 0, 0, true
+	}
+	for _, m := range trackPattern.FindAllStringSubmatch(track, -1) {
+		n, _ := strconv.Atoi(m[2])
+		if m[1] == "ahead" {
+			ahead = n
+		} else {
+			behind = n
+		}
+	}
+	return ahead, behind, false
+}
+
+// MergedBranches returns, for each base, the set of local branches whose
+// tips are reachable from it. Git 2.41 and later answer for all bases in
+// one for-each-ref with %(ahead-behind:<base>); older versions take one
+// for-each-ref --merged per base.
+func (c *Client) MergedBranches(bases []string) (map[string]map[string]bool, error) {
+	result := make(map[string]map[string]bool, len(bases))
+	if len(bases) == 0 {
+		return result, nil
+	}
+
+	if !c.gitVersion().atLeast(2, 41) {
+		for _, base := range bases {
+			output, err := c.output("for-each-ref", "--format=%(refname:short)", "--merged="+base, "refs/heads/")
+			if err != nil {
+				return nil, fmt.Errorf("failed to list branches merged into %s: %w", base, err)
+			}
+			merged := make(map[string]bool)
+			for _, name := range strings.Fields(output) {
+				merged[name] = true
+			}
+			result[base] = merged
+		}
+		return result, nil
+	}
+
+	atoms := []string{"%(refname:short)"}
+	for _, base := range bases {
+		atoms = append(atoms, "%(ahead-behind:"+base+")")
+		result[base] = make(map[string]bool)
+	}
+	output, err := c.output("for-each-ref", "--format="+strings.Join(atoms, "%00"), "refs/heads/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare branches with bases: %w", err)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.Split(line, "\x00")
+		if len(parts) != len(bases)+1 {
+			continue
+		}
+		for i, base := range bases {
+			// "A B": A commits only on the branch, B only on the base.
+			ahead, _, _ := strings.Cut(parts[i+1], " ")
+			if ahead == "0" {
+				result[base][parts[0]] = true
+			}
+		}
+	}
+	return result, nil
+}
+
+// version is a git major.minor version.
+type version struct {
+	major, minor int
+}
+
+func (v version) atLeast(major, minor int) bool {
+	return v.major > major || v.major == major && v.minor >= minor
+}
+
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)`)
+
+// gitVersion returns the installed git's version, or zero if it cannot be
+// read, which selects the older code paths.
+func (c *Client) gitVersion() version {
+	c.versionOnce.Do(func() {
+		output, err := c.output("version")
+		if err != nil {
+			return
+		}
+		if m := versionPattern.FindStringSubmatch(output); m != nil {
+			c.version.major, _ = strconv.Atoi(m[1])
+			c.version.minor, _ = strconv.Atoi(m[2])
+		}
+	})
+	return c.version
+}
@@ -0,0 +1,138 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListBranches(t *testing.T) {
+	dir := newTestRepo(t, 3)
+	tree := runGit(t, dir, "", "rev-parse", "main^{tree}")
+
+	// topic-000 is two ahead and one behind; topic-001's upstream is gone.
+	local := runGit(t, dir, "", "commit-tree", tree, "-p", "topic-000", "-m", "local 1")
+	local = runGit(t, dir, "", "commit-tree", tree, "-p", local, "-m", "local 2")
+	remote := runGit(t, dir, "", "commit-tree", tree, "-p", "topic-000", "-m", "remote")
+	runGit(t, dir, "", "update-ref", "refs/heads/topic-000", local)
+	runGit(t, dir, "", "update-ref", "refs/remotes/origin/topic-000", remote)
+	runGit(t, dir, "", "update-ref", "-d", "refs/remotes/origin/topic-001")
+	runGit(t, dir, "", "checkout", "-q", "--orphan", "fresh")
+
+	branches, err := NewClient(dir).ListBranches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]Branch)
+	for _, b := range branches {
+		byName[b.Name] = b
+	}
+
+	if got := byName["topic-000"]; got.Ahead != 2 || got.Behind != 1 || got.TrackingGone {
+		t.Errorf("topic-000 = %d ahead, %d behind, gone %v, want 2, 1, false", got.Ahead, got.Behind, got.TrackingGone)
+	}
+	if got := byName["topic-000"].LastCommitSHA; got != local {
+		t.Errorf("topic-000 LastCommitSHA = %q, want %q", got, local)
+	}
+	if !byName["topic-001"].TrackingGone {
+		t.Errorf("topic-001 TrackingGone = false, want true")
+	}
+	if got := byName["topic-002"]; got.Ahead != 0 || got.Behind != 0 || got.TrackingGone || got.Author != "Test" {
+		t.Errorf("topic-002 = %+v, want in sync and authored by Test", got)
+	}
+	if got, ok := byName["fresh"]; !ok || !got.IsCurrent || got.LastCommitSHA != "" {
+		t.Errorf("fresh = %+v, %v, want the current branch with no commit", got, ok)
+	}
+}
+
+func TestParseTrack(t *testing.T) {
+	tests := []struct {
+		track         string
+		ahead, behind int
+		gone          bool
+	}{
+		{"", 0, 0, false},
+		{"[gone]", 0, 0, true},
+		{"[ahead 3]", 3, 0, false},
+		{"[behind 12]", 0, 12, false},
+		{"[ahead 1, behind 2]", 1, 2, false},
+	}
+	for _, tt := range tests {
+		ahead, behind, gone := parseTrack(tt.track)
+		if ahead != tt.ahead || behind != tt.behind || gone != tt.gone {
+			t.Errorf("parseTrack(%q) = %d, %d, %v, want %d, %d, %v", tt.track, ahead, behind, gone, tt.ahead, tt.behind, tt.gone)
+		}
+	}
+}
+
+func TestMergedBranchesFallbackAgrees(t *testing.T) {
+	dir := newTestRepo(t, 3)
+	runGit(t, dir, "", "update-ref", "refs/remotes/origin/main", "topic-001")
+	bases := []string{"main", "origin/main"}
+	want := map[string]map[string]bool{
+		"main":        {"main": true},
+		"origin/main": {"main": true, "topic-001": true},
+	}
+
+	c := NewClient(dir)
+	got, err := c.MergedBranches(bases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergedBranches() = %v, want %v", got, want)
+	}
+
+	// A zero version forces the per-base path older git needs.
+	old := NewClient(dir)
+	old.versionOnce.Do(func() {})
+	got, err = old.MergedBranches(bases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergedBranches() on old git = %v, want %v", got, want)
+	}
+}
+
+func TestListBranchesFallbackAgrees(t *testing.T) {
+	dir := newTestRepo(t, 4)
+	runGit(t, dir, "", "update-ref", "refs/heads/release.v1", "topic-000")
+	runGit(t, dir, "", "config", "branch.release.v1.remote", "origin")
+	runGit(t, dir, "", "config", "branch.release.v1.merge", "refs/heads/release.v1")
+	// topic-001 pushes to a fork, topic-002 tracks a local branch and
+	// topic-003 only has a remote without a merge ref.
+	runGit(t, dir, "", "config", "branch.topic-001.pushRemote", "fork")
+	runGit(t, dir, "", "config", "branch.topic-002.remote", ".")
+	runGit(t, dir, "", "config", "branch.topic-002.merge", "refs/heads/main")
+	runGit(t, dir, "", "config", "--unset", "branch.topic-003.merge")
+
+	want, err := NewClient(dir).ListBranches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range want {
+		if b.Name == "topic-001" && b.PushRemote != "fork" {
+			t.Fatalf("topic-001 PushRemote = %q, want fork", b.PushRemote)
+		}
+	}
+
+	for _, pushDefault := range []string{"", "fork"} {
+		if pushDefault != "" {
+			runGit(t, dir, "", "config", "remote.pushDefault", pushDefault)
+			if want, err = NewClient(dir).ListBranches(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// A zero version forces the git config path older git needs.
+		old := NewClient(dir)
+		old.versionOnce.Do(func() {})
+		got, err := old.ListBranches()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ListBranches() on old git with pushDefault %q =\n%+v\nwant\n%+v", pushDefault, got, want)
+		}
+	}
+}
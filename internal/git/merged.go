@@ -0,0 +1,250 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// maxBasePatchIDs bounds how far back in a base branch's history patch-ids
+// are computed when looking for squash and rebase merges.
+const maxBasePatchIDs = 1000
+
+// Ways a branch can end up in a base branch, as recorded in
+// Branch.MergeMethod.
+const (
+	MergedByMerge  = "merge"
+	MergedBySquash = "squash"
+	MergedByRebase = "rebase"
+	MergedByNoOp   = "no-op"
+)
+
+// baseHistoryCache remembers, per base tip, what FindAbsorbingCommit
+// compares branches with, so a scan computes it once per base rather
+// than once per branch.
+type baseHistoryCache struct {
+	mu      sync.Mutex
+	entries map[string]*baseHistory
+}
+
+// baseHistory is a base branch's tip, its tree and the patch-ids of its
+// most recent non-merge commits, mapped to the newest commit with each.
+type baseHistory struct {
+	tip      string
+	tree     string
+	patchIDs map[string]string
+}
+
+// FindAbsorbingCommit detects a branch that was squash-merged or rebased
+// onto base, which merge-base --is-ancestor cannot see. It compares the
+// patch-id of the branch's cumulative diff, and of each of its commits,
+// with the patch-ids of base's recent commits since they diverged. As a last
+// resort it checks whether merging the branch into base would change
+// nothing. It returns the base commit that absorbed the branch (empty for
+// the no-op check) and how it was merged.
+func (c *Client) FindAbsorbingCommit(branch, base string) (commit, method string, ok bool) {
+	// A branch that changes nothing since it forked from base, including
+	// one with no commits of its own, has nothing to absorb.
+	diff, err := c.outputBytes("diff", "--no-color", "--full-index", base+"..."+branch)
+	if err != nil || len(diff) == 0 {
+		return "", "", false
+	}
+
+	history, err := c.baseHistory(base)
+	if err != nil {
+		return "", "", false
+	}
+
+	// Base commits the branch already contains predate the fork and
+	// cannot have absorbed it.
+	since := func(commit string) bool {
+		return !c.isAncestor(commit, branch)
+	}
+
+	if len(history.patchIDs) > 0 {
+		ids, err := c.patchIDs(diff)
+		if err == nil && len(ids) == 1 {
+			if commit, found := history.patchIDs[ids[0].id]; found && since(commit) {
+				return commit, MergedBySquash, true
+			}
+		}
+
+		if commit, found := c.rebasedOnto(branch, history, since); found {
+			return commit, MergedByRebase, true
+		}
+	}
+
+	if c.mergeIsNoOp(branch, history) {
+		return "", MergedByNoOp, true
+	}
+
+	return "", "", false
+}
+
+// rebasedOnto reports whether every non-merge commit of the branch that
+// the base lacks has an equivalent on base since the fork, and returns the
+// newest of those.
+func (c *Client) rebasedOnto(branch string, history *baseHistory, since func(string) bool) (string, bool) {
+	log, err := c.outputBytes("log", "-p", "--no-merges", "--no-color", "--full-index", "--reverse", history.tip+".."+branch)
+	if err != nil {
+		return "", false
+	}
+
+	ids, err := c.patchIDs(log)
+	if err != nil || len(ids) == 0 {
+		return "", false
+	}
+
+	var commits []string
+	for _, id := range ids {
+		commit, found := history.patchIDs[id.id]
+		if !found {
+			return "", false
+		}
+		commits = append(commits, commit)
+	}
+
+	var newest string
+	for _, commit := range commits {
+		if !since(commit) {
+			return "", false
+		}
+		if newest == "" || c.isAncestor(newest, commit) {
+			newest = commit
+		}
+	}
+
+	return newest, true
+}
+
+// mergeIsNoOp reports whether merging branch into the base would leave
+// its tree unchanged, meaning all of the branch's changes are already
+// there. It needs git merge-tree --write-tree (git 2.38); older versions
+// report false.
+func (c *Client) mergeIsNoOp(branch string, history *baseHistory) bool {
+	merged, err := c.output("merge-tree", "--write-tree", history.tip, branch)
+	if err != nil {
+		return false
+	}
+
+	// The first line of merge-tree's output is the resulting tree.
+	tree, _, _ := strings.Cut(merged, "\n")
+	return tree == history.tree
+}
+
+// baseHistory returns what branches are compared with for base, computing
+// it once per base tip. Callers that pass a commit ID rather than a ref
+// name skip resolving it again for every branch.
+func (c *Client) baseHistory(base string) (*baseHistory, error) {
+	tip := base
+	if !isObjectID(base) {
+		resolved, err := c.output("rev-parse", "--verify", "--quiet", base+"^{commit}")
+		if err != nil {
+			return nil, err
+		}
+		tip = resolved
+	}
+
+	c.baseHistoryCache.mu.Lock()
+	cached, ok := c.baseHistoryCache.entries[tip]
+	c.baseHistoryCache.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	tree, err := c.output("rev-parse", tip+"^{tree}")
+	if err != nil {
+		return nil, err
+	}
+
+	log, err := c.outputBytes("log", "-p", "--no-merges", "--no-color", "--full-index",
+		fmt.Sprintf("--max-count=%d", maxBasePatchIDs), tip)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := c.patchIDs(log)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &baseHistory{tip: tip, tree: tree, patchIDs: make(map[string]string, len(ids))}
+	for _, id := range ids {
+		// git log lists newest first; keep the newest commit per patch.
+		if _, seen := history.patchIDs[id.id]; !seen {
+			history.patchIDs[id.id] = id.commit
+		}
+	}
+
+	c.baseHistoryCache.mu.Lock()
+	if c.baseHistoryCache.entries == nil {
+		c.baseHistoryCache.entries = make(map[string]*baseHistory)
+	}
+	c.baseHistoryCache.entries[tip] = history
+	c.baseHistoryCache.mu.Unlock()
+
+	return history, nil
+}
+
+// isObjectID reports whether s is a full SHA-1 or SHA-256 object ID.
+func isObjectID(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+type patchID struct {
+	id     string
+	commit string
+}
+
+// patchIDs runs git patch-id --stable over patch text.
+func (c *Client) patchIDs(patch []byte) ([]patchID, error) {
+	if len(bytes.TrimSpace(patch)) == 0 {
+		return nil, nil
+	}
+
+	cmd := exec.Command("git", "patch-id", "--stable")
+	cmd.Dir = c.workingDir
+	cmd.Stdin = bytes.NewReader(patch)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []patchID
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 {
+			ids = append(ids, patchID{id: fields[0], commit: fields[1]})
+		}
+	}
+	return ids, scanner.Err()
+}
+
+func (c *Client) isAncestor(ancestor, commit string) bool {
+	cmd := exec.Command("git", "merge-base", "--is-ancestor", ancestor, commit)
+	cmd.Dir = c.workingDir
+	return cmd.Run() == nil
+}
+
+func (c *Client) output(args ...string) (string, error) {
+	output, err := c.outputBytes(args...)
+	return strings.TrimSpace(string(output)), err
+}
+
+func (c *Client) outputBytes(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = c.workingDir
+	return cmd.Output()
+}
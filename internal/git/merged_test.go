@@ -0,0 +1,79 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// commitFile writes content to name in dir and commits it.
+func commitFile(t *testing.T, dir, name, content, message string) string {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "", "add", name)
+	runGit(t, dir, "", "commit", "-q", "-m", message)
+	return runGit(t, dir, "", "rev-parse", "HEAD")
+}
+
+func TestFindAbsorbingCommit(t *testing.T) {
+	dir := t.TempDir()
+	runGit(t, dir, "", "init", "-q", "-b", "main")
+	commitFile(t, dir, "README", "hello\n", "initial")
+
+	// squashed: two commits squash-merged into one on main.
+	runGit(t, dir, "", "checkout", "-q", "-b", "squashed")
+	commitFile(t, dir, "a.txt", "one\n", "a: one")
+	commitFile(t, dir, "a.txt", "one\ntwo\n", "a: two")
+
+	// rebased: two commits replayed onto main after it moved on.
+	runGit(t, dir, "", "checkout", "-q", "-b", "rebased", "main")
+	commitFile(t, dir, "b.txt", "one\n", "b: one")
+	commitFile(t, dir, "c.txt", "one\n", "c: one")
+
+	// absorbed: squash-merged together with other changes.
+	runGit(t, dir, "", "checkout", "-q", "-b", "absorbed", "main")
+	commitFile(t, dir, "d.txt", "one\n", "d: one")
+
+	// unmerged and empty never reached main.
+	runGit(t, dir, "", "checkout", "-q", "-b", "unmerged", "main")
+	commitFile(t, dir, "e.txt", "one\n", "e: one")
+	runGit(t, dir, "", "checkout", "-q", "-b", "empty", "main")
+	runGit(t, dir, "", "commit", "-q", "--allow-empty", "-m", "nothing")
+
+	runGit(t, dir, "", "checkout", "-q", "main")
+	commitFile(t, dir, "README", "hello again\n", "unrelated")
+	runGit(t, dir, "", "merge", "-q", "--squash", "squashed")
+	runGit(t, dir, "", "commit", "-q", "-m", "Squashed (#1)")
+	squashCommit := runGit(t, dir, "", "rev-parse", "HEAD")
+	runGit(t, dir, "", "cherry-pick", "rebased~1", "rebased")
+	rebaseCommit := runGit(t, dir, "", "rev-parse", "HEAD")
+	runGit(t, dir, "", "merge", "-q", "--squash", "absorbed")
+	commitFile(t, dir, "README", "hello and more\n", "Absorbed (#2)")
+
+	client := NewClient(dir)
+	tests := []struct {
+		branch     string
+		wantCommit string
+		wantMethod string
+		wantOK     bool
+	}{
+		{branch: "squashed", wantCommit: squashCommit, wantMethod: MergedBySquash, wantOK: true},
+		{branch: "rebased", wantCommit: rebaseCommit, wantMethod: MergedByRebase, wantOK: true},
+		{branch: "absorbed", wantMethod: MergedByNoOp, wantOK: true},
+		{branch: "unmerged"},
+		{branch: "empty"},
+		{branch: "main"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.branch, func(t *testing.T) {
+			commit, method, ok := client.FindAbsorbingCommit(tt.branch, "main")
+			if commit != tt.wantCommit || method != tt.wantMethod || ok != tt.wantOK {
+				t.Errorf("FindAbsorbingCommit(%s) = %q, %q, %v; want %q, %q, %v",
+					tt.branch, commit, method, ok, tt.wantCommit, tt.wantMethod, tt.wantOK)
+			}
+		})
+	}
+}
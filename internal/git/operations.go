@@ -1,17 +1,20 @@
 package git
 
 import (
-	"bufio"
-	"bytes"
 	"fmt"
 	"os/exec"
 	"strconv"
 	"strings"
-	"time"
+	"sync"
 )
 
 type Client struct {
-	workingDir string
+	workingDir       string
+	hostAliases      map[string]string
+	baseHistoryCache baseHistoryCache
+
+	versionOnce sync.Once
+	version     version
 }
 
 func NewClient(workingDir string) *Client {
@@ -40,57 +43,6 @@ func (c *Client) GetCurrentBranch() (string, bool, error) {
 	return "", true, nil
 }
 
-func (c *Client) ListBranches() ([]Branch, error) {
-	cmd := exec.Command("git", "for-each-ref", "--format=%(refname:short)|%(committerdate:iso)|%(authorname)|%(upstream:short)|%(HEAD)", "refs/heads/")
-	cmd.Dir = c.workingDir
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("failed to list branches: %w", err)
-	}
-
-	var branches []Branch
-	scanner := bufio.NewScanner(bytes.NewReader(output))
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Split(line, "|")
-		if len(parts) < 5 {
-			continue
-		}
-
-		name := parts[0]
-		commitDate, _ := time.Parse("2006-01-02 15:04:05 -0700", parts[1])
-		author := parts[2]
-		upstream := parts[3]
-		isCurrent := parts[4] == "*"
-
-		branch := Branch{
-			Name:        name,
-			LastCommit:  commitDate,
-			Author:      author,
-			TrackingRef: upstream,
-			IsCurrent:   isCurrent,
-		}
-
-		if upstream != "" {
-			ahead, behind, err := c.getAheadBehind(name, upstream)
-			if err == nil {
-				branch.Ahead = ahead
-				branch.Behind = behind
-			}
-		}
-
-		commitCount, err := c.getCommitCount(name)
-		if err == nil {
-			branch.CommitCount = commitCount
-		}
-
-		branches = append(branches, branch)
-	}
-
-	return branches, scanner.Err()
-}
-
 func (c *Client) getAheadBehind(local, remote string) (int, int, error) {
 	cmd := exec.Command("git", "rev-list", "--left-right", "--count", fmt.Sprintf("%s...%s", local, remote))
 	cmd.Dir = c.workingDir
@@ -117,26 +69,13 @@ func (c *Client) getAheadBehind(local, remote string) (int, int, error) {
 	return ahead, behind, nil
 }
 
-func (c *Client) getCommitCount(branch string) (int, error) {
-	cmd := exec.Command("git", "rev-list", "--count", branch)
-	cmd.Dir = c.workingDir
-	output, err := cmd.Output()
-	if err != nil {
-		return 0, err
-	}
-
-	count, err := strconv.Atoi(strings.TrimSpace(string(output)))
+// commitOf returns the commit ref points at, or "" if it does not exist.
+func (c *Client) commitOf(ref string) string {
+	commit, err := c.output("rev-parse", "--verify", "--quiet", ref+"^{commit}")
 	if err != nil {
-		return 0, err
+		return ""
 	}
-
-	return count, nil
-}
-
-func (c *Client) RemoteExists(branch string) bool {
-	cmd := exec.Command("git", "rev-parse", "--verify", fmt.Sprintf("origin/%s", branch))
-	cmd.Dir = c.workingDir
-	return cmd.Run() == nil
+	return commit
 }
 
 func (c *Client) IsMergedIntoBase(branch, base string) bool {
@@ -145,34 +84,19 @@ func (c *Client) IsMergedIntoBase(branch, base string) bool {
 	return cmd.Run() == nil
 }
 
-func (c *Client) GetRemoteURL() (string, error) {
-	cmd := exec.Command("git", "config", "--get", "remote.origin.url")
-	cmd.Dir = c.workingDir
-	output, err := cmd.Output()
-	if err != nil {
-		return "", err
+// UpstreamRewritten reports whether upstream was force-pushed or rebased
+// out from under branch: either the two share no history at all, or the
+// last fetch replaced an upstream commit the branch was built on with one
+// that does not contain it.
+func (c *Client) UpstreamRewritten(branch, upstream string) bool {
+	if _, err := c.output("merge-base", branch, upstream); err != nil {
+		return true
 	}
 
-	return strings.TrimSpace(string(output)), nil
-}
-
-func (c *Client) ParseGitHubRepo(remoteURL string) (owner, repo string, err error) {
-	url := strings.TrimSpace(remoteURL)
-
-	if strings.HasPrefix(url, "git@github.com:") {
-		url = strings.TrimPrefix(url, "git@github.com:")
-	} else if strings.HasPrefix(url, "https://github.com/") {
-		url = strings.TrimPrefix(url, "https://github.com/")
-	} else {
-		return "", "", fmt.Errorf("not a GitHub repository URL")
-	}
-
-	url = strings.TrimSuffix(url, ".git")
-
-	parts := strings.Split(url, "/")
-	if len(parts) != 2 {
-		return "", "", fmt.Errorf("invalid GitHub repository format")
+	previous, err := c.output("rev-parse", "--verify", "--quiet", upstream+"@{1}")
+	if err != nil || previous == "" {
+		return false
 	}
 
-	return parts[0], parts[1], nil
+	return !c.isAncestor(previous, upstream) && c.isAncestor(previous, branch)
 }
@@ -0,0 +1,184 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// RemoteRepo identifies the GitHub repository a remote points at.
+type RemoteRepo struct {
+	Host  string
+	Owner string
+	Name  string
+}
+
+func (r RemoteRepo) String() string {
+	return r.Host + "/" + r.Owner + "/" + r.Name
+}
+
+// builtinHostAliases are hostnames that reach github.com under another
+// name.
+var builtinHostAliases = map[string]string{
+	"ssh.github.com": "github.com",
+}
+
+// ParseRemoteURL extracts the host, owner and repository from a remote
+// URL. It understands scp-like SSH addresses (git@host:owner/repo),
+// ssh://, git://, http:// and https:// URLs with optional users and
+// ports, and tolerates a trailing .git and trailing slashes. Hosts found in
+// aliases, such as SSH Host aliases, are replaced by their target.
+func ParseRemoteURL(rawURL string, aliases map[string]string) (RemoteRepo, error) {
+	raw := strings.TrimSpace(rawURL)
+	if raw == "" {
+		return RemoteRepo{}, fmt.Errorf("empty remote URL")
+	}
+
+	var host, path string
+	if strings.Contains(raw, "://") {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return RemoteRepo{}, fmt.Errorf("invalid remote URL %q: %w", rawURL, err)
+		}
+		switch u.Scheme {
+		case "ssh", "git+ssh", "ssh+git", "git", "http", "https":
+		default:
+			return RemoteRepo{}, fmt.Errorf("unsupported remote URL scheme %q", u.Scheme)
+		}
+		host, path = u.Hostname(), u.Path
+	} else {
+		// scp-like syntax: [user@]host:path. A slash before the first
+		// colon means a local path instead.
+		colon := strings.Index(raw, ":")
+		if colon <= 0 || strings.Contains(raw[:colon], "/") {
+			return RemoteRepo{}, fmt.Errorf("not a remote repository URL: %q", rawURL)
+		}
+		host, path = raw[:colon], raw[colon+1:]
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			host = host[at+1:]
+		}
+	}
+
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if target, ok := aliases[host]; ok {
+		host = strings.ToLower(target)
+	} else if target, ok := builtinHostAliases[host]; ok {
+		host = target
+	}
+
+	path = strings.Trim(path, "/")
+	path = strings.TrimSuffix(path, ".git")
+	path = strings.TrimRight(path, "/")
+
+	parts := strings.Split(path, "/")
+	if host == "" || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return RemoteRepo{}, fmt.Errorf("remote URL %q does not name an owner/repository", rawURL)
+	}
+
+	return RemoteRepo{Host: host, Owner: parts[0], Name: parts[1]}, nil
+}
+
+// SetHostAliases adds host aliases, for example from the config file, on
+// top of the ones read from ~/.ssh/config.
+func (c *Client) SetHostAliases(aliases map[string]string) {
+	c.hostAliases = aliases
+}
+
+// ResolveRemote returns the repository the named remote points at. The URL
+// is read with url.<base>.insteadOf rewrites applied, and SSH host aliases
+// are resolved through ~/.ssh/config and the configured alias map.
+func (c *Client) ResolveRemote(remote string) (RemoteRepo, error) {
+	// ls-remote --get-url echoes unknown remotes back, so check that the
+	// remote exists first.
+	if _, err := c.remoteConfig(remote); err != nil {
+		return RemoteRepo{}, fmt.Errorf("remote %s has no URL configured", remote)
+	}
+
+	cmd := exec.Command("git", "ls-remote", "--get-url", remote)
+	cmd.Dir = c.workingDir
+	output, err := cmd.Output()
+	if err != nil {
+		return RemoteRepo{}, fmt.Errorf("failed to read URL of remote %s: %w", remote, err)
+	}
+
+	aliases := sshHostAliases()
+	for alias, host := range c.hostAliases {
+		aliases[strings.ToLower(alias)] = host
+	}
+
+	return ParseRemoteURL(string(output), aliases)
+}
+
+func (c *Client) remoteConfig(remote string) (string, error) {
+	cmd := exec.Command("git", "config", "--get", "remote."+remote+".url")
+	cmd.Dir = c.workingDir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// sshHostAliases reads Host aliases with an explicit HostName from the
+// user's ~/.ssh/config. A missing or unreadable file gives no aliases.
+func sshHostAliases() map[string]string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return map[string]string{}
+	}
+	return readSSHHostAliases(filepath.Join(home, ".ssh", "config"))
+}
+
+// readSSHHostAliases maps each literal Host pattern in the ssh_config file
+// at path to its HostName. Wildcard patterns are skipped, and like ssh the
+// first HostName that applies to a host wins.
+func readSSHHostAliases(path string) map[string]string {
+	aliases := map[string]string{}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return aliases
+	}
+	defer f.Close()
+
+	var hosts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Options are "Key value" or "Key=value".
+		sep := strings.IndexAny(line, " \t=")
+		if sep < 0 {
+			continue
+		}
+		key := strings.ToLower(line[:sep])
+		value := strings.Trim(strings.TrimLeft(line[sep:], " \t="), `"`)
+
+		switch key {
+		case "host":
+			hosts = hosts[:0]
+			for _, pattern := range strings.Fields(value) {
+				if !strings.ContainsAny(pattern, "*?!") {
+					hosts = append(hosts, strings.ToLower(pattern))
+				}
+			}
+		case "match":
+			hosts = hosts[:0]
+		case "hostname":
+			for _, host := range hosts {
+				if _, seen := aliases[host]; !seen && !strings.EqualFold(host, value) && !strings.Contains(value, "%") {
+					aliases[host] = strings.ToLower(value)
+				}
+			}
+		}
+	}
+
+	return aliases
+}
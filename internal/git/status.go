@@ -0,0 +1,72 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// operationMarkers maps files git leaves in the git directory while an
+// operation is in progress to that operation, checked in order.
+var operationMarkers = []struct {
+	path string
+	op   Operation
+}{
+	{"rebase-merge", OpRebase},
+	{"rebase-apply", OpRebase},
+	{"MERGE_HEAD", OpMerge},
+	{"CHERRY_PICK_HEAD", OpCherryPick},
+	{"REVERT_HEAD", OpRevert},
+	{"BISECT_LOG", OpBisect},
+}
+
+// GetStatus reports where HEAD is, how the current branch compares with
+// its upstream, and any operation in progress.
+func (c *Client) GetStatus() (GitStatus, error) {
+	var status GitStatus
+
+	current, detached, err := c.GetCurrentBranch()
+	if err != nil {
+		return status, err
+	}
+	status.CurrentBranch = current
+	status.IsDetached = detached
+
+	// An unborn branch has no commit yet; that is not an error.
+	if out, err := c.output("log", "-1", "--format=%H%x00%s", "HEAD"); err == nil {
+		status.HeadCommit, status.HeadSubject, _ = strings.Cut(out, "\x00")
+	}
+
+	if !detached {
+		if upstream, err := c.output("rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}"); err == nil && upstream != "" {
+			status.HasUpstream = true
+			status.UpstreamRef = upstream
+			status.Ahead, status.Behind, _ = c.getAheadBehind("HEAD", upstream)
+		}
+	}
+
+	op, err := c.InProgressOperation()
+	if err != nil {
+		return status, err
+	}
+	status.Operation = op
+
+	return status, nil
+}
+
+// InProgressOperation returns the rebase, merge, cherry-pick, revert or
+// bisect the current worktree is in the middle of, or "" if none.
+func (c *Client) InProgressOperation() (Operation, error) {
+	gitDir, err := c.output("rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", fmt.Errorf("failed to find git directory: %w", err)
+	}
+
+	for _, marker := range operationMarkers {
+		if _, err := os.Stat(filepath.Join(gitDir, marker.path)); err == nil {
+			return marker.op, nil
+		}
+	}
+	return "", nil
+}
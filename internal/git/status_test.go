@@ -0,0 +1,66 @@
+package git
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGetStatusDetectsDetachedHeadAndOperations(t *testing.T) {
+	dir := t.TempDir()
+	runGit(t, dir, "", "init", "-q", "-b", "main")
+	first := commitFile(t, dir, "a.txt", "one\n", "first")
+	commitFile(t, dir, "a.txt", "two\n", "second")
+
+	client := NewClient(dir)
+
+	status, err := client.GetStatus()
+	if err != nil {
+		t.Fatalf("GetStatus() error = %v", err)
+	}
+	if status.IsDetached || status.CurrentBranch != "main" || status.Operation != "" {
+		t.Errorf("GetStatus() = %+v, want on main with nothing in progress", status)
+	}
+
+	runGit(t, dir, "", "checkout", "-q", "--detach", first)
+	status, err = client.GetStatus()
+	if err != nil {
+		t.Fatalf("GetStatus() error = %v", err)
+	}
+	if !status.IsDetached || status.HeadCommit != first || status.HeadSubject != "first" {
+		t.Errorf("GetStatus() = %+v, want detached at %s", status, first)
+	}
+
+	runGit(t, dir, "", "bisect", "start")
+	if op, err := client.InProgressOperation(); err != nil || op != OpBisect {
+		t.Errorf("InProgressOperation() = %q, %v; want %q", op, err, OpBisect)
+	}
+	runGit(t, dir, "", "bisect", "reset")
+
+	// A conflicting merge stops with MERGE_HEAD in place. The client
+	// runs git without the test identity, so set one in the repository.
+	runGit(t, dir, "", "config", "user.name", "Test")
+	runGit(t, dir, "", "config", "user.email", "test@example.com")
+	runGit(t, dir, "", "checkout", "-q", "-b", "other", first)
+	commitFile(t, dir, "a.txt", "conflict\n", "conflict")
+	if out, err := client.output("merge", "-q", "main"); err == nil {
+		t.Fatalf("git merge succeeded, want conflict:\n%s", out)
+	}
+	if op, err := client.InProgressOperation(); err != nil || op != OpMerge {
+		t.Errorf("InProgressOperation() = %q, %v; want %q", op, err, OpMerge)
+	}
+}
+
+func TestClassifyAllBranchesIgnoresDetachedHead(t *testing.T) {
+	dir := newTestRepo(t, 2)
+	runGit(t, dir, "", "checkout", "-q", "--detach", "topic-000")
+
+	branches, err := NewClassifier(NewClient(dir), &fakeGitHub{}, []string{"main"}).ClassifyAllBranches(context.Background())
+	if err != nil {
+		t.Fatalf("ClassifyAllBranches() error = %v", err)
+	}
+	for _, b := range branches {
+		if b.State == DetachedHead {
+			t.Errorf("%s state = %s, want a per-branch state", b.Name, b.State)
+		}
+	}
+}
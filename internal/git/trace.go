@@ -0,0 +1,51 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TraceStep records one check made while classifying a branch: the rule,
+// the git command or GitHub call behind it, what it found, and any error
+// that classification carried on past.
+type TraceStep struct {
+	Rule   string `json:"rule"`
+	Source string `json:"source,omitempty"`
+	Result string `json:"result"`
+	Err    string `json:"error,omitempty"`
+}
+
+func (s TraceStep) String() string {
+	var b strings.Builder
+	b.WriteString(s.Rule)
+	if s.Result != "" {
+		b.WriteString(": " + s.Result)
+	}
+	if s.Source != "" {
+		b.WriteString("  [" + s.Source + "]")
+	}
+	if s.Err != "" {
+		b.WriteString("\n    ignored error: " + s.Err)
+	}
+	return b.String()
+}
+
+// trace appends a step to the branch's classification trace.
+func (b *Branch) trace(rule, source, result string, err error) {
+	step := TraceStep{Rule: rule, Source: source, Result: result}
+	if err != nil {
+		step.Err = err.Error()
+	}
+	b.Trace = append(b.Trace, step)
+}
+
+// FormatTrace renders the branch's trace as numbered lines, ending with
+// the state it produced.
+func FormatTrace(branch Branch) string {
+	var b strings.Builder
+	for i, step := range branch.Trace {
+		fmt.Fprintf(&b, "%2d. %s\n", i+1, step)
+	}
+	fmt.Fprintf(&b, "=> %s (%s)\n", branch.State, branch.State.DisplayName())
+	return b.String()
+}
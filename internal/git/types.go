@@ -1,10 +1,15 @@
 package git
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 type BranchState string
 
 const (
+	// DetachedHead is kept for compatibility. A detached HEAD is reported
+	// in GitStatus and no longer gives any branch this state.
 	DetachedHead        BranchState = "DETACHED_HEAD"
 	NoUpstream          BranchState = "NO_UPSTREAM"
 	OrphanRemoteDeleted BranchState = "ORPHAN_REMOTE_DELETED"
@@ -24,6 +29,36 @@ const (
 	UpstreamGone        BranchState = "UPSTREAM_GONE"
 )
 
+// AllStates lists every state a branch can be classified as.
+var AllStates = []BranchState{
+	NoUpstream,
+	OrphanRemoteDeleted,
+	InSync,
+	UnpushedAhead,
+	BehindRemote,
+	Diverged,
+	DraftPR,
+	OpenPR,
+	ClosedPR,
+	MergedRemoteExists,
+	StaleLocal,
+	FullyMergedBase,
+	NoCommits,
+	UpstreamChanged,
+	RemoteRenamed,
+	UpstreamGone,
+}
+
+// ParseBranchState returns the state with the given ID, ignoring case.
+func ParseBranchState(id string) (BranchState, bool) {
+	for _, s := range AllStates {
+		if strings.EqualFold(string(s), id) {
+			return s, true
+		}
+	}
+	return "", false
+}
+
 func (s BranchState) DisplayName() string {
 	switch s {
 	case DetachedHead:
@@ -65,22 +100,81 @@ func (s BranchState) DisplayName() string {
 	}
 }
 
+// BranchFlag is a condition that can hold alongside others. State picks
+// one primary state by precedence; Flags records everything that applies.
+type BranchFlag string
+
+const (
+	FlagAhead           BranchFlag = "ahead"
+	FlagBehind          BranchFlag = "behind"
+	FlagDiverged        BranchFlag = "diverged"
+	FlagHasPR           BranchFlag = "has-pr"
+	FlagMergedIntoBase  BranchFlag = "merged-into-base"
+	FlagUpstreamMissing BranchFlag = "upstream-missing"
+	FlagStaleByAge      BranchFlag = "stale-by-age"
+)
+
+// AllFlags lists every BranchFlag in display order.
+var AllFlags = []BranchFlag{
+	FlagAhead,
+	FlagBehind,
+	FlagDiverged,
+	FlagHasPR,
+	FlagMergedIntoBase,
+	FlagUpstreamMissing,
+	FlagStaleByAge,
+}
+
 type Branch struct {
-	Name          string
-	State         BranchState
-	LastCommit    time.Time
-	Author        string
-	Ahead         int
-	Behind        int
-	TrackingRef   string
-	PRNumber      int
-	PRTitle       string
-	PRURL         string
-	IsCurrent     bool
-	CommitCount   int
-	LastCommitSHA string
+	Name          string      `json:"name"`
+	State         BranchState `json:"state"`
+	LastCommit    time.Time   `json:"last_commit,omitzero"`
+	Author        string      `json:"author"`
+	Ahead         int         `json:"ahead"`
+	Behind        int         `json:"behind"`
+	TrackingRef   string      `json:"tracking_ref,omitempty"`
+	PRNumber      int         `json:"pr_number,omitempty"`
+	PRTitle       string      `json:"pr_title,omitempty"`
+	PRURL         string      `json:"pr_url,omitempty"`
+	IsCurrent     bool        `json:"is_current"`
+	LastCommitSHA string      `json:"last_commit_sha,omitempty"`
+	// UpstreamRemote and UpstreamBranch are where the branch pulls from,
+	// from branch.<name>.remote and branch.<name>.merge. PushRemote and
+	// PushRef are where it pushes to, which differs in fork workflows.
+	UpstreamRemote string `json:"upstream_remote,omitempty"`
+	UpstreamBranch string `json:"upstream_branch,omitempty"`
+	PushRemote     string `json:"push_remote,omitempty"`
+	PushRef        string `json:"push_ref,omitempty"`
+	// TrackingGone is set when the upstream is configured but its ref no
+	// longer exists. LastCommitSHA is empty for a branch with no commits.
+	TrackingGone bool `json:"tracking_gone"`
+	// MergedInto is the base branch the branch's work landed in, and
+	// MergedBy the base commit that absorbed it when it was squashed or
+	// rebased rather than merged.
+	MergedInto  string `json:"merged_into,omitempty"`
+	MergedBy    string `json:"merged_by,omitempty"`
+	MergeMethod string `json:"merge_method,omitempty"`
+	// RenamedTo is the new name of an upstream branch renamed on GitHub.
+	RenamedTo string `json:"renamed_to,omitempty"`
+	// Flags are the conditions that hold for the branch regardless of
+	// which one decided State, in AllFlags order.
+	Flags []BranchFlag `json:"flags"`
+	// Trace explains how State and Flags were decided.
+	Trace []TraceStep `json:"trace,omitempty"`
+}
+
+// HasFlag reports whether flag is set on the branch.
+func (b Branch) HasFlag(flag BranchFlag) bool {
+	for _, f := range b.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
 }
 
+// GitStatus describes the repository as a whole: where HEAD is and any
+// operation in progress. Branches are classified without it.
 type GitStatus struct {
 	CurrentBranch string
 	IsDetached    bool
@@ -88,4 +182,21 @@ type GitStatus struct {
 	Behind        int
 	HasUpstream   bool
 	UpstreamRef   string
+	// HeadCommit and HeadSubject identify the commit HEAD points at.
+	HeadCommit  string
+	HeadSubject string
+	// Operation is the rebase, merge, cherry-pick, revert or bisect in
+	// progress, or empty.
+	Operation Operation
 }
+
+// Operation is a multi-step git command left in progress.
+type Operation string
+
+const (
+	OpRebase     Operation = "rebase"
+	OpMerge      Operation = "merge"
+	OpCherryPick Operation = "cherry-pick"
+	OpRevert     Operation = "revert"
+	OpBisect     Operation = "bisect"
+)
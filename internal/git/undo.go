@@ -0,0 +1,107 @@
+package git
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DeletedBranch is a branch removed by a cleanup, with what is needed to
+// put it back: git branch -d drops the branch's reflog and its config.
+type DeletedBranch struct {
+	Name           string    `json:"name"`
+	Commit         string    `json:"commit"`
+	UpstreamRemote string    `json:"upstream_remote,omitempty"`
+	UpstreamMerge  string    `json:"upstream_merge,omitempty"`
+	DeletedAt      time.Time `json:"deleted_at"`
+}
+
+// undoLog is the file holding the most recent cleanup of one repository.
+type undoLog struct {
+	Deleted []DeletedBranch `json:"deleted"`
+}
+
+// undoLogPath returns the undo log for this repository inside dir. Logs
+// are keyed by the shared git directory, so all worktrees use one.
+func (c *Client) undoLogPath(dir string) (string, error) {
+	gitDir, err := c.output("rev-parse", "--path-format=absolute", "--git-common-dir")
+	if err != nil {
+		return "", fmt.Errorf("failed to locate git directory: %w", err)
+	}
+	sum := sha256.Sum256([]byte(gitDir))
+	return filepath.Join(dir, "undo", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// RecordDeletions replaces the undo log in dir with deleted, so that a
+// later undo can bring them back.
+func (c *Client) RecordDeletions(dir string, deleted []DeletedBranch) error {
+	path, err := c.undoLogPath(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create undo directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(undoLog{Deleted: deleted}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write undo log: %w", err)
+	}
+	return nil
+}
+
+// LastDeletions returns the branches the most recent cleanup deleted that
+// have not been restored yet.
+func (c *Client) LastDeletions(dir string) ([]DeletedBranch, error) {
+	path, err := c.undoLogPath(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read undo log: %w", err)
+	}
+
+	var log undoLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		return nil, fmt.Errorf("failed to parse undo log %s: %w", path, err)
+	}
+	return log.Deleted, nil
+}
+
+// RestoreBranch recreates a deleted branch at its old commit and restores
+// its upstream. It fails if a branch of that name exists again.
+func (c *Client) RestoreBranch(b DeletedBranch) error {
+	if _, err := c.output("branch", "--no-track", b.Name, b.Commit); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return fmt.Errorf("failed to restore branch %s: %w", b.Name, err)
+	}
+
+	if b.UpstreamRemote != "" && b.UpstreamMerge != "" {
+		if _, err := c.output("config", "branch."+b.Name+".remote", b.UpstreamRemote); err != nil {
+			return fmt.Errorf("failed to restore upstream of %s: %w", b.Name, err)
+		}
+		if _, err := c.output("config", "branch."+b.Name+".merge", b.UpstreamMerge); err != nil {
+			return fmt.Errorf("failed to restore upstream of %s: %w", b.Name, err)
+		}
+	}
+	return nil
+}
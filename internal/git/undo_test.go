@@ -0,0 +1,55 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordAndRestoreDeletions(t *testing.T) {
+	dir := newTestRepo(t, 2)
+	cacheDir := t.TempDir()
+	c := NewClient(dir)
+
+	commit := runGit(t, dir, "", "rev-parse", "topic-000")
+	deleted := []DeletedBranch{{
+		Name:           "topic-000",
+		Commit:         commit,
+		UpstreamRemote: "origin",
+		UpstreamMerge:  "refs/heads/topic-000",
+		DeletedAt:      time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC),
+	}}
+	if err := c.DeleteBranch("topic-000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RecordDeletions(cacheDir, deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.LastDeletions(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, deleted) {
+		t.Errorf("LastDeletions() = %+v, want %+v", got, deleted)
+	}
+
+	if err := c.RestoreBranch(got[0]); err != nil {
+		t.Fatalf("RestoreBranch() error = %v", err)
+	}
+	if got := runGit(t, dir, "", "rev-parse", "topic-000"); got != commit {
+		t.Errorf("restored topic-000 = %s, want %s", got, commit)
+	}
+	if got := runGit(t, dir, "", "rev-parse", "--abbrev-ref", "topic-000@{upstream}"); got != "origin/topic-000" {
+		t.Errorf("restored upstream = %s, want origin/topic-000", got)
+	}
+
+	if err := c.RestoreBranch(got[0]); err == nil {
+		t.Error("RestoreBranch() over an existing branch = nil, want an error")
+	}
+
+	// Another repository has its own log.
+	if got, err := NewClient(newTestRepo(t, 1)).LastDeletions(cacheDir); err != nil || got != nil {
+		t.Errorf("LastDeletions() in another repo = %v, %v, want nil, nil", got, err)
+	}
+}
@@ -2,28 +2,182 @@ package github
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/google/go-github/v68/github"
 	"golang.org/x/oauth2"
+
+	"github.com/dfinster/branch-wrangler/internal/config"
 )
 
 const (
 	GitHubClientID = "Ov23liOMSfFBJ3w6rK1U"
 	DeviceCodeURL  = "https://github.com/login/device/code"
 	TokenURL       = "https://github.com/login/oauth/access_token"
+
+	defaultPollInterval = 5 * time.Second
+	slowDownIncrement   = 5 * time.Second
+)
+
+var (
+	ErrDeviceCodeExpired = errors.New("the login code expired before it was authorized")
+	ErrAccessDenied      = errors.New("the login request was denied")
+	ErrNoToken           = errors.New("no GitHub token found")
 )
 
+// TokenSource records where the active token came from.
+type TokenSource string
+
+const (
+	SourceNone          TokenSource = ""
+	SourceEnv           TokenSource = "env"
+	SourceConfig        TokenSource = "config"
+	SourceTokenFile     TokenSource = "token_file"
+	SourceGHCLI         TokenSource = "gh_cli"
+	SourceGitCredential TokenSource = "git_credential"
+	SourceDeviceFlow    TokenSource = "device_flow"
+)
+
+// Description names the source for messages. Use describeSource when the
+// environment variable is known.
+func (s TokenSource) Description() string {
+	switch s {
+	case SourceEnv:
+		return "environment variable"
+	case SourceConfig:
+		return "config-file"
+	case SourceTokenFile:
+		return "token-file"
+	case SourceGHCLI:
+		return "gh CLI"
+	case SourceGitCredential:
+		return "git credential helper"
+	case SourceDeviceFlow:
+		return "device-flow login"
+	default:
+		return "GitHub"
+	}
+}
+
+// describeSource names source, including the environment variable env
+// for SourceEnv.
+func describeSource(source TokenSource, env string) string {
+	if source == SourceEnv && env != "" {
+		return env + " environment variable"
+	}
+	return source.Description()
+}
+
+// InvalidTokenError reports that GitHub rejected the token from Source.
+type InvalidTokenError struct {
+	Source TokenSource
+	// Env is the environment variable read for SourceEnv.
+	Env  string
+	Path string
+	Err  error
+}
+
+func (e *InvalidTokenError) Error() string {
+	msg := fmt.Sprintf("your %s token is invalid or expired", describeSource(e.Source, e.Env))
+
+	switch e.Source {
+	case SourceEnv:
+		env := e.Env
+		if env == "" {
+			env = "the environment variable"
+		}
+		msg += fmt.Sprintf(" - update or unset %s, or run 'branch-wrangler --login'", env)
+	case SourceConfig:
+		msg += fmt.Sprintf(" - run 'branch-wrangler --login' to sign in again, or remove the token: key from %s", e.Path)
+	case SourceTokenFile:
+		msg += fmt.Sprintf(" - replace the token in %s, or run 'branch-wrangler --login'", e.Path)
+	case SourceGHCLI:
+		msg += " - run 'gh auth login' to refresh it, or 'branch-wrangler --login'"
+	case SourceGitCredential:
+		msg += " - update the credential stored for GitHub in your git credential helper, or run 'branch-wrangler --login'"
+	default:
+		msg += " - run 'branch-wrangler --login' to sign in again"
+	}
+
+	return msg
+}
+
+func (e *InvalidTokenError) Unwrap() error {
+	return e.Err
+}
+
 type AuthConfig struct {
 	Token    string
 	TokenEnv string
 	Config   *oauth2.Config
+
+	// Source records which step of the precedence chain produced Token.
+	Source TokenSource
+	// ConfigToken is the token stored for Host in the config file.
+	ConfigToken string
+	// TokenPath is a file holding a token, from github_token_path or
+	// --github-token-path.
+	TokenPath string
+	// Host is the GitHub host credentials are looked up for.
+	Host string
+	// UseGHCLI enables reading the gh CLI hosts.yml file.
+	UseGHCLI bool
+	// UseGitCredentials enables asking git credential helpers.
+	UseGitCredentials bool
+
+	// ConfigPath is the config file tokens are saved to. Empty means the
+	// default location.
+	ConfigPath string
+	// HTTPClient is used for the device flow requests. Nil means
+	// http.DefaultClient.
+	HTTPClient *http.Client
+	// Prompt shows the device code to the user. Nil prints to stderr.
+	Prompt func(code *DeviceCode)
+	// Warn reports a token source that was skipped because it could not
+	// be read. Nil prints to stderr.
+	Warn func(msg string)
+
+	sleep func(ctx context.Context, d time.Duration) error
+
+	// scopes holds the X-OAuth-Scopes reported by ValidateToken;
+	// scopesKnown is false when the token type does not report scopes.
+	scopes      []string
+	scopesKnown bool
+}
+
+// DeviceCode is the response to a device authorization request.
+type DeviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	Scope            string `json:"scope"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	Interval         int    `json:"interval"`
 }
 
 func NewAuthConfig() *AuthConfig {
 	return &AuthConfig{
+		TokenEnv:          "GITHUB_TOKEN",
+		Host:              config.DefaultHost,
+		UseGHCLI:          true,
+		UseGitCredentials: true,
 		Config: &oauth2.Config{
 			ClientID: GitHubClientID,
 			Scopes:   []string{"repo", "workflow"},
@@ -36,54 +190,393 @@ func NewAuthConfig() *AuthConfig {
 	}
 }
 
+// SetHost points authentication at a GitHub Enterprise Server host. Its
+// device-flow endpoints live on the host itself, tokens are read from
+// GH_ENTERPRISE_TOKEN like the gh CLI does, and clientID names the OAuth
+// app registered on that server. Passing github.com restores the defaults.
+func (a *AuthConfig) SetHost(host, clientID string) {
+	if config.IsDefaultHost(host) {
+		defaults := NewAuthConfig()
+		a.Host = defaults.Host
+		a.TokenEnv = defaults.TokenEnv
+		a.Config.Endpoint = defaults.Config.Endpoint
+		a.Config.ClientID = defaults.Config.ClientID
+		if clientID != "" {
+			a.Config.ClientID = clientID
+		}
+		return
+	}
+
+	a.Host = host
+	a.TokenEnv = "GH_ENTERPRISE_TOKEN"
+	a.Config.ClientID = clientID
+	a.Config.Endpoint = oauth2.Endpoint{
+		AuthURL:       "https://" + host + "/login/oauth/authorize",
+		TokenURL:      "https://" + host + "/login/oauth/access_token",
+		DeviceAuthURL: "https://" + host + "/login/device/code",
+	}
+}
+
+// newAPIClient returns a REST client for a.Host using httpClient.
+func (a *AuthConfig) newAPIClient(httpClient *http.Client) (*github.Client, error) {
+	client := github.NewClient(httpClient)
+	if config.IsDefaultHost(a.Host) {
+		return client, nil
+	}
+
+	client, err := client.WithEnterpriseURLs("https://"+a.Host+"/api/v3/", "https://"+a.Host+"/api/uploads/")
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub host %q: %w", a.Host, err)
+	}
+	return client, nil
+}
+
+// GetToken returns the first token found in, in order: the TokenEnv
+// environment variable, the config file token: key, the file at
+// TokenPath, the gh CLI hosts.yml and git credential helpers. It returns
+// ErrNoToken when none is set, in which case the caller should fall back
+// to DeviceFlow.
 func (a *AuthConfig) GetToken() (string, error) {
-	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
-		return token, nil
+	if a.Token != "" {
+		return a.Token, nil
+	}
+
+	if a.TokenEnv != "" {
+		if token := strings.TrimSpace(os.Getenv(a.TokenEnv)); token != "" {
+			return a.useToken(token, SourceEnv), nil
+		}
 	}
 
-	return "", fmt.Errorf("GITHUB_TOKEN environment variable not set - please set it to your GitHub Personal Access Token")
+	if token := strings.TrimSpace(a.ConfigToken); token != "" {
+		return a.useToken(token, SourceConfig), nil
+	}
+
+	if a.TokenPath != "" {
+		path, err := config.ExpandHome(a.TokenPath)
+		if err != nil {
+			return "", err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to read token file %s: %w", path, err)
+		}
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return a.useToken(token, SourceTokenFile), nil
+		}
+	}
+
+	if a.UseGHCLI {
+		// A broken hosts.yml is not worth failing over; the sources after
+		// it may still have a token.
+		token, err := readGHCLIToken(a.Host)
+		if err != nil {
+			a.warn(fmt.Sprintf("ignoring gh CLI token: %v", err))
+		}
+		if token != "" {
+			return a.useToken(token, SourceGHCLI), nil
+		}
+	}
+
+	if a.UseGitCredentials {
+		token, err := readGitCredential(context.Background(), a.Host)
+		if err != nil {
+			return "", err
+		}
+		if token != "" {
+			return a.useToken(token, SourceGitCredential), nil
+		}
+	}
+
+	return "", ErrNoToken
+}
+
+func (a *AuthConfig) warn(msg string) {
+	if a.Warn != nil {
+		a.Warn(msg)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s\n", msg)
+}
+
+func (a *AuthConfig) useToken(token string, source TokenSource) string {
+	a.Token = token
+	a.Source = source
+	return token
 }
 
+// DeviceFlow runs the complete OAuth device flow: it requests a device
+// code, shows it to the user via Prompt, waits for authorization and saves
+// the resulting token to the config file.
 func (a *AuthConfig) DeviceFlow(ctx context.Context) (string, error) {
-	return "", fmt.Errorf("device flow not implemented - please set GITHUB_TOKEN environment variable")
+	code, err := a.RequestDeviceCode(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if a.Prompt != nil {
+		a.Prompt(code)
+	} else {
+		PrintDeviceCode(os.Stderr, code)
+	}
+
+	token, err := a.PollForToken(ctx, code)
+	if err != nil {
+		return "", err
+	}
+
+	a.useToken(token, SourceDeviceFlow)
+	if err := a.SaveToken(token); err != nil {
+		return token, fmt.Errorf("logged in, but failed to save token: %w", err)
+	}
+
+	return token, nil
 }
 
-func (a *AuthConfig) SaveToken(token string) error {
-	configPath, err := getConfigPath()
+// PrintDeviceCode writes login instructions for code to w.
+func PrintDeviceCode(w io.Writer, code *DeviceCode) {
+	fmt.Fprintf(w, "To authenticate with GitHub, open %s\nand enter the code: %s\n\nWaiting for authorization...\n",
+		code.VerificationURI, code.UserCode)
+}
+
+// RequestDeviceCode starts the device flow and returns the code the user
+// must enter at the verification URI.
+func (a *AuthConfig) RequestDeviceCode(ctx context.Context) (*DeviceCode, error) {
+	if a.Config.ClientID == "" {
+		return nil, fmt.Errorf("no OAuth client ID configured for %s - set hosts.%s.client_id in the config file, or provide a token", a.Host, a.Host)
+	}
+
+	form := url.Values{
+		"client_id": {a.Config.ClientID},
+		"scope":     {strings.Join(a.Config.Scopes, " ")},
+	}
+
+	var code DeviceCode
+	if err := a.postForm(ctx, a.Config.Endpoint.DeviceAuthURL, form, &code); err != nil {
+		return nil, fmt.Errorf("failed to request a login code from GitHub: %w", err)
+	}
+
+	if code.DeviceCode == "" || code.UserCode == "" {
+		return nil, fmt.Errorf("failed to request a login code from GitHub: incomplete response")
+	}
+
+	return &code, nil
+}
+
+// PollForToken waits for the user to authorize code and returns the access
+// token. It honors the server-provided polling interval and slow_down
+// responses, and gives up once the code expires.
+func (a *AuthConfig) PollForToken(ctx context.Context, code *DeviceCode) (string, error) {
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	if code.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(code.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+
+	form := url.Values{
+		"client_id":   {a.Config.ClientID},
+		"device_code": {code.DeviceCode},
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+	}
+
+	for {
+		if err := a.wait(ctx, interval); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return "", ErrDeviceCodeExpired
+			}
+			return "", err
+		}
+
+		var resp tokenResponse
+		var oauthErr *oauthError
+		if err := a.postForm(ctx, a.Config.Endpoint.TokenURL, form, &resp); errors.As(err, &oauthErr) {
+			resp.Error, resp.ErrorDescription, resp.Interval = oauthErr.Code, oauthErr.Description, oauthErr.Interval
+		} else if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return "", ErrDeviceCodeExpired
+			}
+			return "", fmt.Errorf("failed to check login status: %w", err)
+		}
+
+		switch resp.Error {
+		case "":
+			if resp.AccessToken == "" {
+				return "", fmt.Errorf("GitHub returned an empty access token")
+			}
+			return resp.AccessToken, nil
+		case "authorization_pending":
+		case "slow_down":
+			if resp.Interval > 0 {
+				interval = time.Duration(resp.Interval) * time.Second
+			} else {
+				interval += slowDownIncrement
+			}
+		case "expired_token":
+			return "", ErrDeviceCodeExpired
+		case "access_denied":
+			return "", ErrAccessDenied
+		default:
+			if resp.ErrorDescription != "" {
+				return "", fmt.Errorf("login failed: %s", resp.ErrorDescription)
+			}
+			return "", fmt.Errorf("login failed: %s", resp.Error)
+		}
+	}
+}
+
+func (a *AuthConfig) wait(ctx context.Context, d time.Duration) error {
+	if a.sleep != nil {
+		return a.sleep(ctx, d)
+	}
+	return sleepContext(ctx, d)
+}
+
+func (a *AuthConfig) postForm(ctx context.Context, endpoint string, form url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	client := a.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
 	if err != nil {
 		return err
 	}
 
-	return writeTokenToConfig(configPath, token)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		// RFC 8628 servers other than github.com send errors such as
+		// authorization_pending with status 400.
+		var oauthErr oauthError
+		if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Code != "" {
+			return &oauthErr
+		}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+
+	return json.Unmarshal(body, out)
+}
+
+// oauthError is an OAuth error response sent with a 4xx status.
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+	Interval    int    `json:"interval"`
+}
+
+func (e *oauthError) Error() string {
+	if e.Description != "" {
+		return e.Code + ": " + e.Description
+	}
+	return e.Code
+}
+
+func (a *AuthConfig) SaveToken(token string) error {
+	return writeTokenToConfig(a.ConfigPath, a.Host, token)
 }
 
 func (a *AuthConfig) ValidateToken(token string) error {
-	client := github.NewClient(oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(
+	client, err := a.newAPIClient(oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: token},
 	)))
+	if err != nil {
+		return err
+	}
+
+	_, resp, err := client.RateLimit.Get(context.Background())
+	if err == nil {
+		a.scopes, a.scopesKnown = parseScopes(resp.Header)
+		return nil
+	}
+
+	var ghErr *github.ErrorResponse
+	if errors.As(err, &ghErr) && ghErr.Response != nil && ghErr.Response.StatusCode == http.StatusUnauthorized {
+		return &InvalidTokenError{Source: a.Source, Env: a.TokenEnv, Path: a.sourcePath(), Err: err}
+	}
 
-	_, _, err := client.RateLimit.Get(context.Background())
-	return err
+	return fmt.Errorf("failed to validate %s token: %w", a.SourceDescription(), err)
 }
 
-func getConfigPath() (string, error) {
-	configDir := os.Getenv("XDG_CONFIG_HOME")
-	if configDir == "" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return "", err
+// SourceDescription names where the token in use came from.
+func (a *AuthConfig) SourceDescription() string {
+	return describeSource(a.Source, a.TokenEnv)
+}
+
+// sourcePath returns the file the active token was read from, if any.
+func (a *AuthConfig) sourcePath() string {
+	switch a.Source {
+	case SourceConfig, SourceDeviceFlow:
+		if a.ConfigPath != "" {
+			return a.ConfigPath
 		}
-		configDir = filepath.Join(homeDir, ".config")
+		path, _ := config.GetConfigPath()
+		return path
+	case SourceTokenFile:
+		path, _ := config.ExpandHome(a.TokenPath)
+		return path
+	case SourceGHCLI:
+		path, _ := ghHostsPath()
+		return path
+	}
+	return ""
+}
+
+// Logout removes the stored token from the config file. It reports
+// whether there was a token to remove.
+func (a *AuthConfig) Logout() (bool, error) {
+	cfg, err := config.Load(a.ConfigPath)
+	if err != nil {
+		return false, err
 	}
 
-	appConfigDir := filepath.Join(configDir, "branch-wrangler")
-	if err := os.MkdirAll(appConfigDir, 0700); err != nil {
-		return "", err
+	if cfg.HostToken(a.Host) == "" {
+		return false, nil
+	}
+
+	cfg.ClearHostToken(a.Host)
+	if err := cfg.Save(); err != nil {
+		return false, err
+	}
+
+	if a.Source == SourceConfig || a.Source == SourceDeviceFlow {
+		a.Token = ""
+		a.Source = SourceNone
 	}
+	a.ConfigToken = ""
 
-	return filepath.Join(appConfigDir, "config.yml"), nil
+	return true, nil
 }
 
-func writeTokenToConfig(configPath, token string) error {
-	return fmt.Errorf("config file writing not implemented yet")
+// writeTokenToConfig stores the token for host, keeping earlier tokens as
+// versioned comments, with owner-only permissions.
+func writeTokenToConfig(configPath, host, token string) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+
+	cfg.SetHostToken(host, token)
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+
+	return cfg.SecureDir()
 }
@@ -0,0 +1,485 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeOAuthServer serves the device code endpoint and answers token polls
+// with the given sequence of JSON bodies.
+type fakeOAuthServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	responses []string
+	polls     int
+	// errorStatus, when set, is the HTTP status of error responses, as
+	// RFC 8628 servers other than github.com send them.
+	errorStatus int
+}
+
+func newFakeOAuthServer(t *testing.T, responses ...string) *fakeOAuthServer {
+	t.Helper()
+
+	f := &fakeOAuthServer{responses: responses}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/device/code", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("client_id") == "" {
+			http.Error(w, "missing client_id", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"device_code":"dev-123","user_code":"ABCD-1234","verification_uri":"https://example.test/device","expires_in":900,"interval":5}`)
+	})
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("device_code") != "dev-123" {
+			http.Error(w, "bad device code", http.StatusBadRequest)
+			return
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		body := f.responses[min(f.polls, len(f.responses)-1)]
+		f.polls++
+		w.Header().Set("Content-Type", "application/json")
+		if f.errorStatus != 0 && strings.Contains(body, `"error"`) {
+			w.WriteHeader(f.errorStatus)
+		}
+		fmt.Fprint(w, body)
+	})
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// newTestAuth returns an AuthConfig pointed at server that records poll
+// intervals instead of sleeping.
+func newTestAuth(t *testing.T, server *fakeOAuthServer, intervals *[]time.Duration) *AuthConfig {
+	t.Helper()
+
+	auth := NewAuthConfig()
+	auth.Config.Endpoint.DeviceAuthURL = server.URL + "/login/device/code"
+	auth.Config.Endpoint.TokenURL = server.URL + "/login/oauth/access_token"
+	auth.ConfigPath = filepath.Join(t.TempDir(), "config.yml")
+	auth.Prompt = func(*DeviceCode) {}
+	auth.sleep = func(ctx context.Context, d time.Duration) error {
+		*intervals = append(*intervals, d)
+		return ctx.Err()
+	}
+	return auth
+}
+
+func TestDeviceFlowSuccess(t *testing.T) {
+	server := newFakeOAuthServer(t,
+		`{"error":"authorization_pending"}`,
+		`{"error":"slow_down","interval":10}`,
+		`{"error":"authorization_pending"}`,
+		`{"access_token":"gho_test","token_type":"bearer","scope":"repo,workflow"}`,
+	)
+
+	var intervals []time.Duration
+	auth := newTestAuth(t, server, &intervals)
+
+	var prompted *DeviceCode
+	auth.Prompt = func(code *DeviceCode) { prompted = code }
+
+	token, err := auth.DeviceFlow(context.Background())
+	if err != nil {
+		t.Fatalf("DeviceFlow() error = %v", err)
+	}
+	if token != "gho_test" {
+		t.Errorf("DeviceFlow() token = %q, want gho_test", token)
+	}
+
+	if prompted == nil || prompted.UserCode != "ABCD-1234" {
+		t.Errorf("Prompt called with %+v, want user code ABCD-1234", prompted)
+	}
+
+	want := []time.Duration{5 * time.Second, 5 * time.Second, 10 * time.Second, 10 * time.Second}
+	if fmt.Sprint(intervals) != fmt.Sprint(want) {
+		t.Errorf("poll intervals = %v, want %v", intervals, want)
+	}
+
+	data, err := os.ReadFile(auth.ConfigPath)
+	if err != nil {
+		t.Fatalf("token was not saved: %v", err)
+	}
+	if !strings.Contains(string(data), "token: gho_test") {
+		t.Errorf("saved config missing token:\n%s", data)
+	}
+}
+
+func TestPollForTokenSlowDownWithoutInterval(t *testing.T) {
+	server := newFakeOAuthServer(t,
+		`{"error":"slow_down"}`,
+		`{"access_token":"gho_test"}`,
+	)
+
+	var intervals []time.Duration
+	auth := newTestAuth(t, server, &intervals)
+
+	if _, err := auth.PollForToken(context.Background(), &DeviceCode{DeviceCode: "dev-123"}); err != nil {
+		t.Fatalf("PollForToken() error = %v", err)
+	}
+
+	want := []time.Duration{5 * time.Second, 10 * time.Second}
+	if fmt.Sprint(intervals) != fmt.Sprint(want) {
+		t.Errorf("poll intervals = %v, want %v", intervals, want)
+	}
+}
+
+func TestPollForTokenErrorsWithStatus400(t *testing.T) {
+	server := newFakeOAuthServer(t,
+		`{"error":"authorization_pending"}`,
+		`{"error":"slow_down","interval":10}`,
+		`{"access_token":"gho_test"}`,
+	)
+	server.errorStatus = http.StatusBadRequest
+
+	var intervals []time.Duration
+	auth := newTestAuth(t, server, &intervals)
+
+	token, err := auth.PollForToken(context.Background(), &DeviceCode{DeviceCode: "dev-123"})
+	if err != nil || token != "gho_test" {
+		t.Fatalf("PollForToken() = %q, %v; want gho_test", token, err)
+	}
+	want := []time.Duration{5 * time.Second, 5 * time.Second, 10 * time.Second}
+	if fmt.Sprint(intervals) != fmt.Sprint(want) {
+		t.Errorf("poll intervals = %v, want %v", intervals, want)
+	}
+
+	expired := newFakeOAuthServer(t, `{"error":"expired_token"}`)
+	expired.errorStatus = http.StatusBadRequest
+	if _, err := newTestAuth(t, expired, &intervals).PollForToken(context.Background(), &DeviceCode{DeviceCode: "dev-123"}); !errors.Is(err, ErrDeviceCodeExpired) {
+		t.Errorf("PollForToken() error = %v, want %v", err, ErrDeviceCodeExpired)
+	}
+}
+
+func TestPollForTokenErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		wantErr  error
+		wantText string
+	}{
+		{name: "expired", response: `{"error":"expired_token"}`, wantErr: ErrDeviceCodeExpired},
+		{name: "denied", response: `{"error":"access_denied"}`, wantErr: ErrAccessDenied},
+		{name: "other", response: `{"error":"device_flow_disabled","error_description":"Device flow is disabled"}`, wantText: "Device flow is disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeOAuthServer(t, tt.response)
+
+			var intervals []time.Duration
+			auth := newTestAuth(t, server, &intervals)
+
+			_, err := auth.DeviceFlow(context.Background())
+			if err == nil {
+				t.Fatal("DeviceFlow() expected error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("DeviceFlow() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantText != "" && !strings.Contains(err.Error(), tt.wantText) {
+				t.Errorf("DeviceFlow() error = %v, want it to mention %q", err, tt.wantText)
+			}
+			if _, statErr := os.Stat(auth.ConfigPath); statErr == nil {
+				t.Error("config file written despite failed login")
+			}
+		})
+	}
+}
+
+func TestPollForTokenExpiresByDeadline(t *testing.T) {
+	server := newFakeOAuthServer(t, `{"error":"authorization_pending"}`)
+
+	var intervals []time.Duration
+	auth := newTestAuth(t, server, &intervals)
+	auth.sleep = func(ctx context.Context, d time.Duration) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	_, err := auth.PollForToken(context.Background(), &DeviceCode{DeviceCode: "dev-123", ExpiresIn: 1})
+	if !errors.Is(err, ErrDeviceCodeExpired) {
+		t.Errorf("PollForToken() error = %v, want %v", err, ErrDeviceCodeExpired)
+	}
+}
+
+func TestGetTokenPrecedence(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "github-token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ghDir := t.TempDir()
+	hosts := "github.com:\n    user: octocat\n    oauth_token: gh-token\n    git_protocol: ssh\n"
+	if err := os.WriteFile(filepath.Join(ghDir, "hosts.yml"), []byte(hosts), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	gitConfig := filepath.Join(t.TempDir(), "gitconfig")
+	helper := "[credential]\n\thelper = \"!f() { echo username=octocat; echo password=git-token; }; f\"\n"
+	if err := os.WriteFile(gitConfig, []byte(helper), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GIT_CONFIG_GLOBAL", gitConfig)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	tests := []struct {
+		name        string
+		env         string
+		configToken string
+		tokenPath   string
+		ghDir       string
+		useGit      bool
+		wantToken   string
+		wantSource  TokenSource
+		wantErr     error
+	}{
+		{name: "env wins", env: "env-token", configToken: "config-token", tokenPath: tokenFile, ghDir: ghDir, useGit: true, wantToken: "env-token", wantSource: SourceEnv},
+		{name: "config before file", configToken: "config-token", tokenPath: tokenFile, ghDir: ghDir, useGit: true, wantToken: "config-token", wantSource: SourceConfig},
+		{name: "token file before gh", tokenPath: tokenFile, ghDir: ghDir, useGit: true, wantToken: "file-token", wantSource: SourceTokenFile},
+		{name: "gh before git", ghDir: ghDir, useGit: true, wantToken: "gh-token", wantSource: SourceGHCLI},
+		{name: "git credential", useGit: true, wantToken: "git-token", wantSource: SourceGitCredential},
+		{name: "missing token file", tokenPath: filepath.Join(t.TempDir(), "missing"), wantErr: ErrNoToken},
+		{name: "nothing set", wantErr: ErrNoToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GITHUB_TOKEN", tt.env)
+			t.Setenv("GH_CONFIG_DIR", tt.ghDir)
+
+			auth := NewAuthConfig()
+			auth.ConfigToken = tt.configToken
+			auth.TokenPath = tt.tokenPath
+			auth.UseGHCLI = tt.ghDir != ""
+			auth.UseGitCredentials = tt.useGit
+
+			token, err := auth.GetToken()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetToken() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetToken() error = %v", err)
+			}
+			if token != tt.wantToken {
+				t.Errorf("GetToken() = %q, want %q", token, tt.wantToken)
+			}
+			if auth.Source != tt.wantSource {
+				t.Errorf("Source = %q, want %q", auth.Source, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestGetTokenSkipsMalformedGHHosts(t *testing.T) {
+	ghDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(ghDir, "hosts.yml"), []byte("github.com: [oauth_token: {\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	gitConfig := filepath.Join(t.TempDir(), "gitconfig")
+	helper := "[credential]\n\thelper = \"!f() { echo username=octocat; echo password=git-token; }; f\"\n"
+	if err := os.WriteFile(gitConfig, []byte(helper), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GH_CONFIG_DIR", ghDir)
+	t.Setenv("GIT_CONFIG_GLOBAL", gitConfig)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	tests := []struct {
+		name       string
+		useGit     bool
+		wantToken  string
+		wantSource TokenSource
+		wantErr    error
+	}{
+		{name: "falls through to git credentials", useGit: true, wantToken: "git-token", wantSource: SourceGitCredential},
+		{name: "falls through to device flow", wantErr: ErrNoToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warnings []string
+			auth := NewAuthConfig()
+			auth.UseGHCLI = true
+			auth.UseGitCredentials = tt.useGit
+			auth.Warn = func(msg string) { warnings = append(warnings, msg) }
+
+			token, err := auth.GetToken()
+			if !errors.Is(err, tt.wantErr) || token != tt.wantToken || auth.Source != tt.wantSource {
+				t.Errorf("GetToken() = %q (%s), %v; want %q (%s), %v", token, auth.Source, err, tt.wantToken, tt.wantSource, tt.wantErr)
+			}
+			if len(warnings) != 1 || !strings.Contains(warnings[0], "hosts.yml") {
+				t.Errorf("warnings = %q, want one naming hosts.yml", warnings)
+			}
+		})
+	}
+}
+
+func TestReadGHCLITokenMultiAccount(t *testing.T) {
+	dir := t.TempDir()
+	hosts := `github.com:
+    user: work
+    git_protocol: https
+    users:
+        personal:
+            oauth_token: personal-token
+        work:
+            oauth_token: work-token
+`
+	if err := os.WriteFile(filepath.Join(dir, "hosts.yml"), []byte(hosts), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GH_CONFIG_DIR", dir)
+
+	token, err := readGHCLIToken("github.com")
+	if err != nil {
+		t.Fatalf("readGHCLIToken() error = %v", err)
+	}
+	if token != "work-token" {
+		t.Errorf("readGHCLIToken() = %q, want work-token", token)
+	}
+}
+
+func TestInvalidTokenErrorNamesSource(t *testing.T) {
+	tests := []struct {
+		err  *InvalidTokenError
+		want []string
+	}{
+		{&InvalidTokenError{Source: SourceConfig, Path: "/tmp/config.yml"}, []string{"config-file token is invalid or expired", "--login"}},
+		{&InvalidTokenError{Source: SourceEnv, Env: "GITHUB_TOKEN"}, []string{"GITHUB_TOKEN environment variable token", "unset GITHUB_TOKEN"}},
+		{&InvalidTokenError{Source: SourceEnv, Env: "GH_ENTERPRISE_TOKEN"}, []string{"GH_ENTERPRISE_TOKEN environment variable token", "unset GH_ENTERPRISE_TOKEN"}},
+	}
+
+	for _, tt := range tests {
+		msg := tt.err.Error()
+		for _, want := range tt.want {
+			if !strings.Contains(msg, want) {
+				t.Errorf("Error() = %q, want it to contain %q", msg, want)
+			}
+		}
+		if tt.err.Env == "GH_ENTERPRISE_TOKEN" && strings.Contains(msg, "GITHUB_TOKEN") {
+			t.Errorf("Error() = %q names GITHUB_TOKEN for a GH_ENTERPRISE_TOKEN token", msg)
+		}
+	}
+}
+
+func TestSourceDescriptionNamesEnterpriseVariable(t *testing.T) {
+	auth := NewAuthConfig()
+	auth.SetHost("ghe.example.com", "")
+	auth.Source = SourceEnv
+
+	if got, want := auth.SourceDescription(), "GH_ENTERPRISE_TOKEN environment variable"; got != want {
+		t.Errorf("SourceDescription() = %q, want %q", got, want)
+	}
+	info := &TokenInfo{Source: SourceEnv, env: auth.TokenEnv}
+	if got, want := info.Summary(), "GH_ENTERPRISE_TOKEN environment variable token"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+}
+
+func TestSetHostUsesEnterpriseEndpoints(t *testing.T) {
+	auth := NewAuthConfig()
+	auth.SetHost("ghe.example.com", "Iv1.enterprise")
+
+	if auth.TokenEnv != "GH_ENTERPRISE_TOKEN" {
+		t.Errorf("TokenEnv = %q, want GH_ENTERPRISE_TOKEN", auth.TokenEnv)
+	}
+	if got, want := auth.Config.Endpoint.DeviceAuthURL, "https://ghe.example.com/login/device/code"; got != want {
+		t.Errorf("DeviceAuthURL = %q, want %q", got, want)
+	}
+	if got, want := auth.Config.Endpoint.TokenURL, "https://ghe.example.com/login/oauth/access_token"; got != want {
+		t.Errorf("TokenURL = %q, want %q", got, want)
+	}
+	if auth.Config.ClientID != "Iv1.enterprise" {
+		t.Errorf("ClientID = %q, want Iv1.enterprise", auth.Config.ClientID)
+	}
+
+	client, err := auth.newAPIClient(nil)
+	if err != nil {
+		t.Fatalf("newAPIClient() error = %v", err)
+	}
+	if got, want := client.BaseURL.String(), "https://ghe.example.com/api/v3/"; got != want {
+		t.Errorf("BaseURL = %q, want %q", got, want)
+	}
+	if got, want := client.UploadURL.String(), "https://ghe.example.com/api/uploads/"; got != want {
+		t.Errorf("UploadURL = %q, want %q", got, want)
+	}
+
+	auth.SetHost("github.com", "")
+	if auth.TokenEnv != "GITHUB_TOKEN" || auth.Config.ClientID != GitHubClientID || auth.Config.Endpoint.TokenURL != TokenURL {
+		t.Errorf("SetHost(github.com) did not restore defaults: %+v", auth.Config)
+	}
+}
+
+func TestEnterpriseDeviceFlowNeedsClientID(t *testing.T) {
+	auth := NewAuthConfig()
+	auth.SetHost("ghe.example.com", "")
+
+	_, err := auth.RequestDeviceCode(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "hosts.ghe.example.com.client_id") {
+		t.Errorf("RequestDeviceCode() error = %v, want hint about client_id", err)
+	}
+}
+
+func TestSaveTokenPerHost(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+
+	for _, tt := range []struct{ host, token string }{
+		{"github.com", "dotcom-token"},
+		{"ghe.example.com", "ghe-token"},
+	} {
+		auth := NewAuthConfig()
+		auth.SetHost(tt.host, "")
+		auth.ConfigPath = path
+		if err := auth.SaveToken(tt.token); err != nil {
+			t.Fatalf("SaveToken(%s) error = %v", tt.host, err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	if !strings.Contains(out, "\ntoken: dotcom-token") && !strings.HasPrefix(out, "token: dotcom-token") {
+		t.Errorf("github.com token not saved at top level:\n%s", out)
+	}
+	if !strings.Contains(out, "ghe.example.com:\n    token: ghe-token") {
+		t.Errorf("enterprise token not saved under hosts:\n%s", out)
+	}
+
+	auth := NewAuthConfig()
+	auth.SetHost("ghe.example.com", "")
+	auth.ConfigPath = path
+	if removed, err := auth.Logout(); err != nil || !removed {
+		t.Fatalf("Logout() = %v, %v; want true, nil", removed, err)
+	}
+
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "token: ghe-token") || !strings.Contains(string(data), "token: dotcom-token") {
+		t.Errorf("Logout() should only remove the enterprise token:\n%s", data)
+	}
+}
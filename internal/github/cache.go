@@ -0,0 +1,254 @@
+package github
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long cached API answers are used without asking
+// GitHub again.
+const DefaultCacheTTL = 15 * time.Minute
+
+// maxCacheAge is how long an entry is kept on disk after it was stored or,
+// for ETag responses, last revalidated. Answers are not trusted past the
+// TTL anyway; this only bounds the file as branches come and go.
+const maxCacheAge = 7 * 24 * time.Hour
+
+// CacheOptions configures the persistent response cache.
+type CacheOptions struct {
+	// Dir is the cache root. Entries for each repository are stored in
+	// Dir/<owner>/<repo>.json, or Dir/<host>/<owner>/<repo>.json on GitHub
+	// Enterprise Server.
+	Dir string
+	// TTL is how long answers are trusted before revalidating.
+	TTL time.Duration
+	// Disabled keeps the cache in memory only for the current run.
+	Disabled bool
+}
+
+// diskCache is a goroutine-safe key/value store that can be persisted to a
+// JSON file.
+type diskCache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]*diskEntry
+	dirty   bool
+}
+
+type diskEntry struct {
+	Data     json.RawMessage `json:"data,omitempty"`
+	ETag     string          `json:"etag,omitempty"`
+	Response []byte          `json:"response,omitempty"`
+	StoredAt time.Time       `json:"stored_at"`
+}
+
+// openDiskCache loads the cache file at path. An empty path gives an
+// in-memory cache; a missing or unreadable file gives an empty one.
+func openDiskCache(path string) *diskCache {
+	c := &diskCache{path: path, entries: make(map[string]*diskEntry)}
+	if path == "" {
+		return c
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c
+	}
+
+	// A corrupt cache is simply discarded.
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		c.entries = make(map[string]*diskEntry)
+	}
+	c.prune(time.Now())
+
+	return c
+}
+
+// prune drops entries older than maxCacheAge. The caller holds c.mu or
+// has the cache to itself.
+func (c *diskCache) prune(now time.Time) {
+	for key, entry := range c.entries {
+		if entry == nil || now.Sub(entry.StoredAt) > maxCacheAge {
+			delete(c.entries, key)
+			c.dirty = true
+		}
+	}
+}
+
+// get decodes the value stored under key into out if it is younger than
+// ttl.
+func (c *diskCache) get(key string, ttl time.Duration, out interface{}) bool {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+
+	if !ok || entry.Data == nil || time.Since(entry.StoredAt) >= ttl {
+		return false
+	}
+
+	return json.Unmarshal(entry.Data, out) == nil
+}
+
+func (c *diskCache) set(key string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = &diskEntry{Data: data, StoredAt: time.Now()}
+	c.dirty = true
+}
+
+func (c *diskCache) getResponse(key string) (*diskEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || entry.ETag == "" {
+		return nil, false
+	}
+	return entry, true
+}
+
+// touchResponse marks the response stored under key as revalidated, so
+// it is kept as long as GitHub keeps confirming it.
+func (c *diskCache) touchResponse(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[key]; ok {
+		entry.StoredAt = time.Now()
+		c.dirty = true
+	}
+}
+
+func (c *diskCache) setResponse(key, etag string, response []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = &diskEntry{ETag: etag, Response: response, StoredAt: time.Now()}
+	c.dirty = true
+}
+
+// save writes the cache back to disk if anything changed.
+func (c *diskCache) save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	c.prune(time.Now())
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(c.entries)
+	c.dirty = false
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".cache-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// ClearCache removes every cached response under dir.
+func ClearCache(dir string) error {
+	err := os.RemoveAll(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// etagTransport revalidates GET requests with If-None-Match. GitHub does
+// not count 304 Not Modified answers against the rate limit, so repeated
+// lookups of unchanged data are free.
+type etagTransport struct {
+	base  http.RoundTripper
+	cache *diskCache
+}
+
+func (t *etagTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.base.RoundTrip(req)
+	}
+
+	key := "http:" + req.URL.String()
+	cached, haveCached := t.cache.getResponse(key)
+	if haveCached {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && haveCached {
+		stored, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(cached.Response)), req)
+		if err != nil {
+			return resp, nil
+		}
+		resp.Body.Close()
+		t.cache.touchResponse(key)
+		// Keep the fresh rate-limit headers from the 304.
+		for _, h := range []string{"X-Ratelimit-Limit", "X-Ratelimit-Remaining", "X-Ratelimit-Reset", "X-Ratelimit-Used"} {
+			if v := resp.Header.Get(h); v != "" {
+				stored.Header.Set(h, v)
+			}
+		}
+		return stored, nil
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+
+			if dump, err := httputil.DumpResponse(resp, true); err == nil {
+				t.cache.setResponse(key, etag, dump)
+			}
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+		}
+	}
+
+	return resp, nil
+}
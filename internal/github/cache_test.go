@@ -0,0 +1,153 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v68/github"
+)
+
+func TestETagTransportRevalidates(t *testing.T) {
+	var requests, notModified int
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.Header().Set("X-RateLimit-Remaining", "4999")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("X-RateLimit-Remaining", "4998")
+		fmt.Fprint(w, `[{"number":5,"title":"Cached","state":"open"}]`)
+	})
+
+	c := newTestClient(t, nil, mux)
+	cached := github.NewClient(&http.Client{Transport: &etagTransport{base: http.DefaultTransport, cache: openDiskCache("")}})
+	cached.BaseURL = c.client.BaseURL
+	c.client = cached
+
+	for i := 0; i < 2; i++ {
+		prs, err := c.GetPullRequestsForBranch(context.Background(), featureHead)
+		if err != nil {
+			t.Fatalf("GetPullRequestsForBranch() error = %v", err)
+		}
+		if len(prs) != 1 || prs[0].Number != 5 {
+			t.Errorf("request %d: PullRequests = %+v, want #5", i, prs)
+		}
+	}
+
+	if requests != 2 || notModified != 1 {
+		t.Errorf("requests = %d, 304s = %d; want 2 and 1", requests, notModified)
+	}
+}
+
+func TestDiskCachePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "octo", "repo.json")
+
+	cache := openDiskCache(path)
+	cache.set("pr:feature", []PullRequest{{Number: 3, State: "open"}})
+	cache.setResponse("http:https://example.com", `"abc"`, []byte("HTTP/1.1 200 OK\r\n\r\n"))
+	if err := cache.save(); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	reopened := openDiskCache(path)
+
+	var prs []PullRequest
+	if !reopened.get("pr:feature", time.Hour, &prs) || len(prs) != 1 || prs[0].Number != 3 {
+		t.Errorf("get() after reopen = %+v, want PR #3", prs)
+	}
+	if reopened.get("pr:feature", 0, &prs) {
+		t.Error("get() with zero TTL should miss")
+	}
+	if entry, ok := reopened.getResponse("http:https://example.com"); !ok || entry.ETag != `"abc"` {
+		t.Errorf("getResponse() = %+v, %v; want ETag \"abc\"", entry, ok)
+	}
+
+	if err := ClearCache(filepath.Dir(filepath.Dir(path))); err != nil {
+		t.Fatalf("ClearCache() error = %v", err)
+	}
+	if cleared := openDiskCache(path); len(cleared.entries) != 0 {
+		t.Errorf("entries after ClearCache = %d, want 0", len(cleared.entries))
+	}
+}
+
+func TestDiskCachePrunesOldEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "octo", "repo.json")
+	now := time.Now()
+
+	cache := openDiskCache(path)
+	cache.set("pr:fresh", []PullRequest{{Number: 1}})
+	cache.set("pr:old", []PullRequest{{Number: 2}})
+	cache.setResponse("http:fresh", `"a"`, []byte("HTTP/1.1 200 OK\r\n\r\n"))
+	cache.setResponse("http:old", `"b"`, []byte("HTTP/1.1 200 OK\r\n\r\n"))
+	cache.setResponse("http:revalidated", `"c"`, []byte("HTTP/1.1 200 OK\r\n\r\n"))
+	for _, key := range []string{"pr:old", "http:old", "http:revalidated"} {
+		cache.entries[key].StoredAt = now.Add(-maxCacheAge - time.Hour)
+	}
+	cache.touchResponse("http:revalidated")
+
+	if err := cache.save(); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"pr:old", "http:old"} {
+		if strings.Contains(string(data), key) {
+			t.Errorf("saved cache still has %s", key)
+		}
+	}
+
+	// Entries that age out between runs are dropped on load too.
+	stale := openDiskCache(path)
+	stale.entries["pr:fresh"].StoredAt = now.Add(-maxCacheAge - time.Hour)
+	data, err = json.Marshal(stale.entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	reopened := openDiskCache(path)
+	var keys []string
+	for key := range reopened.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if want := []string{"http:fresh", "http:revalidated"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("entries after pruning = %q, want %q", keys, want)
+	}
+}
+
+func TestDiskCacheConcurrentAccess(t *testing.T) {
+	cache := openDiskCache(filepath.Join(t.TempDir(), "repo.json"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := fmt.Sprintf("branch:b%d", i%5)
+			cache.set(key, true)
+			var exists bool
+			cache.get(key, time.Hour, &exists)
+			_ = cache.save()
+		}()
+	}
+	wg.Wait()
+}
@@ -2,17 +2,38 @@ package github
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/google/go-github/v68/github"
 	"golang.org/x/oauth2"
+
+	"github.com/dfinster/branch-wrangler/internal/config"
 )
 
 type Client struct {
-	client *github.Client
-	auth   *AuthConfig
-	owner  string
-	repo   string
+	client    *github.Client
+	auth      *AuthConfig
+	owner     string
+	repo      string
+	tokenInfo *TokenInfo
+	limits    *rateLimitTransport
+}
+
+// Head names the branch a pull request would be opened from. In a fork
+// workflow it lives in the fork (Owner/Repo), not in the repository the
+// pull request targets.
+type Head struct {
+	Owner  string
+	Repo   string
+	Branch string
+}
+
+func (h Head) String() string {
+	return h.Owner + "/" + h.Repo + ":" + h.Branch
 }
 
 type PullRequest struct {
@@ -24,9 +45,17 @@ type PullRequest struct {
 	URL    string
 }
 
-func NewClient(owner, repo string) (*Client, error) {
-	auth := NewAuthConfig()
+func NewClient(auth *AuthConfig, owner, repo string) (*Client, error) {
+	return newClient(auth, owner, repo, nil)
+}
+
+// newClient authenticates and builds the API client. When cache is not
+// nil, GET requests are revalidated against it with ETags.
+func newClient(auth *AuthConfig, owner, repo string, cache *diskCache) (*Client, error) {
 	token, err := auth.GetToken()
+	if errors.Is(err, ErrNoToken) {
+		token, err = auth.DeviceFlow(context.Background())
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -35,21 +64,75 @@ func NewClient(owner, repo string) (*Client, error) {
 		return nil, err
 	}
 
+	var transport http.RoundTripper = http.DefaultTransport
+	if cache != nil {
+		transport = &etagTransport{base: transport, cache: cache}
+	}
+	limits := newRateLimitTransport(transport)
+
 	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-	tc := oauth2.NewClient(context.Background(), ts)
-	client := github.NewClient(tc)
+	tc := &http.Client{Transport: &oauth2.Transport{Source: ts, Base: limits}}
+	client, err := auth.newAPIClient(tc)
+	if err != nil {
+		return nil, err
+	}
 
-	return &Client{
+	c := &Client{
 		client: client,
 		auth:   auth,
 		owner:  owner,
 		repo:   repo,
-	}, nil
+		limits: limits,
+	}
+	c.tokenInfo = c.inspectToken(context.Background(), token)
+
+	return c, nil
 }
 
-func (c *Client) GetPullRequestsForBranch(ctx context.Context, branch string) ([]PullRequest, error) {
+// TokenInfo describes the token the client authenticates with.
+func (c *Client) TokenInfo() *TokenInfo {
+	return c.tokenInfo
+}
+
+// Repo returns the repository pull requests are looked up in.
+func (c *Client) Repo() (owner, repo string) {
+	return c.owner, c.repo
+}
+
+// Parent returns the repository the client's repository was forked from.
+// ok is false when it is not a fork.
+func (c *Client) Parent(ctx context.Context) (owner, repo string, ok bool, err error) {
+	r, _, err := c.client.Repositories.Get(ctx, c.owner, c.repo)
+	if err != nil {
+		return "", "", false, err
+	}
+	if !r.GetFork() || r.GetParent() == nil {
+		return "", "", false, nil
+	}
+	parent := r.GetParent()
+	return parent.GetOwner().GetLogin(), parent.GetName(), true, nil
+}
+
+// DefaultBranch returns the default branch of the repository pull
+// requests are looked up in.
+func (c *Client) DefaultBranch(ctx context.Context) (string, error) {
+	r, _, err := c.client.Repositories.Get(ctx, c.owner, c.repo)
+	if err != nil {
+		return "", err
+	}
+	return r.GetDefaultBranch(), nil
+}
+
+// SetRepo changes the repository pull requests are looked up in.
+func (c *Client) SetRepo(owner, repo string) {
+	c.owner, c.repo = owner, repo
+}
+
+// GetPullRequestsForBranch lists pull requests into the client's
+// repository from head, which may be in a fork.
+func (c *Client) GetPullRequestsForBranch(ctx context.Context, head Head) ([]PullRequest, error) {
 	opts := &github.PullRequestListOptions{
-		Head:        c.owner + ":" + branch,
+		Head:        head.Owner + ":" + head.Branch,
 		State:       "all",
 		ListOptions: github.ListOptions{PerPage: 100},
 	}
@@ -82,15 +165,36 @@ func (c *Client) GetPullRequestsForBranch(ctx context.Context, branch string) ([
 	return allPRs, nil
 }
 
-func (c *Client) GetRateLimit(ctx context.Context) (*github.RateLimits, error) {
+// GetRateLimit returns the core API rate limit as of the last response.
+// Before any request has been made it asks GitHub, which does not count
+// against the limit.
+func (c *Client) GetRateLimit(ctx context.Context) (RateLimitState, error) {
+	if c.limits != nil {
+		if state := c.limits.state("core"); state.Known {
+			return state, nil
+		}
+	}
+
 	limits, _, err := c.client.RateLimit.Get(ctx)
-	return limits, err
+	if err != nil {
+		return RateLimitState{}, err
+	}
+
+	core := limits.GetCore()
+	return RateLimitState{
+		Limit:     core.Limit,
+		Remaining: core.Remaining,
+		Reset:     core.Reset.Time,
+		Known:     true,
+	}, nil
 }
 
-func (c *Client) BranchExists(ctx context.Context, branch string) (bool, error) {
-	_, _, err := c.client.Repositories.GetBranch(ctx, c.owner, c.repo, branch, 1)
+// BranchExists reports whether head's branch still exists in its
+// repository.
+func (c *Client) BranchExists(ctx context.Context, head Head) (bool, error) {
+	_, resp, err := c.client.Repositories.GetBranch(ctx, head.Owner, head.Repo, head.Branch, 1)
 	if err != nil {
-		if ghErr, ok := err.(*github.ErrorResponse); ok && ghErr.Response.StatusCode == 404 {
+		if isNotFound(resp) {
 			return false, nil
 		}
 		return false, err
@@ -98,71 +202,289 @@ func (c *Client) BranchExists(ctx context.Context, branch string) (bool, error)
 	return true, nil
 }
 
+// BranchStatus is what GitHub reports about a head's branch. RenamedTo is
+// set when the branch was renamed, in which case Exists is true.
+type BranchStatus struct {
+	Exists    bool
+	RenamedTo string
+}
+
+// LookupBranch checks head's branch, following GitHub's redirect from a
+// renamed branch to its new name. When the name is not found, pull requests
+// in the base repository that contain commit are checked for one from the
+// same owner whose head ref now has another name.
+func (c *Client) LookupBranch(ctx context.Context, head Head, commit string) (BranchStatus, error) {
+	branch, resp, err := c.client.Repositories.GetBranch(ctx, head.Owner, head.Repo, head.Branch, 1)
+	if err == nil {
+		status := BranchStatus{Exists: true}
+		if name := branch.GetName(); name != "" && name != head.Branch {
+			status.RenamedTo = name
+		}
+		return status, nil
+	}
+	if !isNotFound(resp) {
+		return BranchStatus{}, err
+	}
+	return c.findRenamedHead(ctx, head, commit)
+}
+
+// findRenamedHead looks for a pull request in the base repository that
+// contains commit and comes from head's owner under another branch name
+// that still exists.
+func (c *Client) findRenamedHead(ctx context.Context, head Head, commit string) (BranchStatus, error) {
+	if commit == "" {
+		return BranchStatus{}, nil
+	}
+
+	prs, resp, err := c.client.PullRequests.ListPullRequestsWithCommit(ctx, c.owner, c.repo, commit, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		if isNotFound(resp) {
+			return BranchStatus{}, nil
+		}
+		return BranchStatus{}, err
+	}
+
+	for _, pr := range prs {
+		ref := pr.GetHead().GetRef()
+		if ref == "" || ref == head.Branch || !strings.EqualFold(pr.GetHead().GetRepo().GetOwner().GetLogin(), head.Owner) {
+			continue
+		}
+		exists, err := c.BranchExists(ctx, Head{Owner: head.Owner, Repo: head.Repo, Branch: ref})
+		if err != nil {
+			return BranchStatus{}, err
+		}
+		if exists {
+			return BranchStatus{Exists: true, RenamedTo: ref}, nil
+		}
+	}
+
+	return BranchStatus{}, nil
+}
+
+// isNotFound reports whether GitHub answered 404. GetBranch reports its
+// status in a plain error, so the response is checked rather than the
+// error type.
+func isNotFound(resp *github.Response) bool {
+	return resp != nil && resp.StatusCode == http.StatusNotFound
+}
+
 type CachedClient struct {
 	client *Client
-	cache  map[string]cacheEntry
+	cache  *diskCache
+	ttl    time.Duration
 }
 
-type cacheEntry struct {
-	data      interface{}
-	timestamp time.Time
-	ttl       time.Duration
-}
+// NewCachedClient returns a client whose answers are cached for opts.TTL
+// and, unless opts.Disabled is set, persisted in opts.Dir between runs.
+func NewCachedClient(auth *AuthConfig, owner, repo string, opts CacheOptions) (*CachedClient, error) {
+	path := ""
+	if !opts.Disabled && opts.Dir != "" {
+		path = filepath.Join(opts.Dir, owner, repo+".json")
+		if !config.IsDefaultHost(auth.Host) {
+			path = filepath.Join(opts.Dir, auth.Host, owner, repo+".json")
+		}
+	}
+	cache := openDiskCache(path)
 
-func NewCachedClient(owner, repo string) (*CachedClient, error) {
-	client, err := NewClient(owner, repo)
+	client, err := newClient(auth, owner, repo, cache)
 	if err != nil {
 		return nil, err
 	}
 
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+
 	return &CachedClient{
 		client: client,
-		cache:  make(map[string]cacheEntry),
+		cache:  cache,
+		ttl:    ttl,
 	}, nil
 }
 
-func (c *CachedClient) GetPullRequestsForBranch(ctx context.Context, branch string) ([]PullRequest, error) {
-	cacheKey := "pr:" + branch
+// UseParentRepo switches pull request lookups to the repository the
+// client's repository was forked from, if it is a fork. The answer is
+// cached like other lookups.
+func (c *CachedClient) UseParentRepo(ctx context.Context) (bool, error) {
+	owner, repo := c.client.Repo()
+	cacheKey := "parent:" + owner + "/" + repo
 
-	if entry, exists := c.cache[cacheKey]; exists {
-		if time.Since(entry.timestamp) < entry.ttl {
-			return entry.data.([]PullRequest), nil
+	var parent []string
+	if !c.cache.get(cacheKey, c.ttl, &parent) {
+		parentOwner, parentRepo, ok, err := c.client.Parent(ctx)
+		if err != nil {
+			return false, err
 		}
+		parent = []string{}
+		if ok {
+			parent = []string{parentOwner, parentRepo}
+		}
+		c.cache.set(cacheKey, parent)
+	}
+
+	if len(parent) != 2 {
+		return false, nil
+	}
+	c.client.SetRepo(parent[0], parent[1])
+	return true, nil
+}
+
+// DefaultBranch is Client.DefaultBranch with caching.
+func (c *CachedClient) DefaultBranch(ctx context.Context) (string, error) {
+	owner, repo := c.client.Repo()
+	cacheKey := "default:" + owner + "/" + repo
+
+	var cached string
+	if c.cache.get(cacheKey, c.ttl, &cached) {
+		return cached, nil
 	}
 
-	prs, err := c.client.GetPullRequestsForBranch(ctx, branch)
+	branch, err := c.client.DefaultBranch(ctx)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	c.cache[cacheKey] = cacheEntry{
-		data:      prs,
-		timestamp: time.Now(),
-		ttl:       15 * time.Minute,
+	c.cache.set(cacheKey, branch)
+
+	return branch, nil
+}
+
+// Repo returns the repository pull requests are looked up in.
+func (c *CachedClient) Repo() (owner, repo string) {
+	return c.client.Repo()
+}
+
+// SetRepo changes the repository pull requests are looked up in.
+func (c *CachedClient) SetRepo(owner, repo string) {
+	c.client.SetRepo(owner, repo)
+}
+
+// prKey and branchKey include the base repository, since UseParentRepo
+// can change it between runs.
+func (c *CachedClient) prKey(head Head) string {
+	owner, repo := c.client.Repo()
+	return "pr:" + owner + "/" + repo + ":" + head.String()
+}
+
+func (c *CachedClient) branchKey(head Head) string {
+	return "branch:" + head.String()
+}
+
+// lookupKey includes the base repository, whose pull requests are searched
+// for renames, and the commit, since a new push can change the answer.
+func (c *CachedClient) lookupKey(head Head, commit string) string {
+	owner, repo := c.client.Repo()
+	return "lookup:" + owner + "/" + repo + ":" + head.String() + "@" + commit
+}
+
+// cachedExists returns the cached answer to BranchExists for head, if any.
+func (c *CachedClient) cachedExists(head Head) (exists, ok bool) {
+	ok = c.cache.get(c.branchKey(head), c.ttl, &exists)
+	return exists, ok
+}
+
+func (c *CachedClient) GetPullRequestsForBranch(ctx context.Context, head Head) ([]PullRequest, error) {
+	cacheKey := c.prKey(head)
+
+	var cached []PullRequest
+	if c.cache.get(cacheKey, c.ttl, &cached) {
+		return cached, nil
 	}
 
+	prs, err := c.client.GetPullRequestsForBranch(ctx, head)
+	if err != nil {
+		return nil, err
+	}
+
+	c.cache.set(cacheKey, prs)
+
 	return prs, nil
 }
 
-func (c *CachedClient) BranchExists(ctx context.Context, branch string) (bool, error) {
-	cacheKey := "branch:" + branch
+func (c *CachedClient) BranchExists(ctx context.Context, head Head) (bool, error) {
+	cacheKey := c.branchKey(head)
 
-	if entry, exists := c.cache[cacheKey]; exists {
-		if time.Since(entry.timestamp) < entry.ttl {
-			return entry.data.(bool), nil
-		}
+	var cached bool
+	if c.cache.get(cacheKey, c.ttl, &cached) {
+		return cached, nil
 	}
 
-	exists, err := c.client.BranchExists(ctx, branch)
+	exists, err := c.client.BranchExists(ctx, head)
 	if err != nil {
 		return false, err
 	}
 
-	c.cache[cacheKey] = cacheEntry{
-		data:      exists,
-		timestamp: time.Now(),
-		ttl:       15 * time.Minute,
-	}
+	c.cache.set(cacheKey, exists)
 
 	return exists, nil
 }
+
+// LookupBranch is Client.LookupBranch with caching. When the branch is
+// already known not to exist, from BranchExists or PrefetchBranches, only
+// pull requests are searched for a rename.
+func (c *CachedClient) LookupBranch(ctx context.Context, head Head, commit string) (BranchStatus, error) {
+	cacheKey := c.lookupKey(head, commit)
+
+	var cached BranchStatus
+	if c.cache.get(cacheKey, c.ttl, &cached) {
+		return cached, nil
+	}
+
+	var status BranchStatus
+	var err error
+	if exists, known := c.cachedExists(head); known && !exists {
+		status, err = c.client.findRenamedHead(ctx, head, commit)
+	} else {
+		status, err = c.client.LookupBranch(ctx, head, commit)
+	}
+	if err != nil {
+		return BranchStatus{}, err
+	}
+
+	c.cache.set(cacheKey, status)
+
+	return status, nil
+}
+
+// PrefetchBranches fills the cache for heads with one batched GraphQL
+// lookup, so later GetPullRequestsForBranch and BranchExists calls for
+// them do not hit the API.
+func (c *CachedClient) PrefetchBranches(ctx context.Context, heads []Head) error {
+	var missing []Head
+	for _, head := range heads {
+		var prs []PullRequest
+		var exists bool
+		if !c.cache.get(c.prKey(head), c.ttl, &prs) || !c.cache.get(c.branchKey(head), c.ttl, &exists) {
+			missing = append(missing, head)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	infos, err := c.client.GetBranchInfo(ctx, missing)
+	if err != nil {
+		return err
+	}
+
+	for head, info := range infos {
+		c.cache.set(c.prKey(head), info.PullRequests)
+		c.cache.set(c.branchKey(head), info.HeadExists)
+	}
+
+	return nil
+}
+
+// SaveCache persists cached answers so the next run can reuse them.
+func (c *CachedClient) SaveCache() error {
+	return c.cache.save()
+}
+
+func (c *CachedClient) TokenInfo() *TokenInfo {
+	return c.client.TokenInfo()
+}
+
+func (c *CachedClient) GetRateLimit(ctx context.Context) (RateLimitState, error) {
+	return c.client.GetRateLimit(ctx)
+}
@@ -0,0 +1,99 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLookupBranch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo/branches/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/octo/repo/branches/feature", "/repos/octo/repo/branches/renamed", "/repos/octo/repo/branches/moved":
+			fmt.Fprintf(w, `{"name":%q}`, r.URL.Path[len("/repos/octo/repo/branches/"):])
+		case "/repos/octo/repo/branches/old":
+			// GitHub redirects requests for a renamed branch.
+			http.Redirect(w, r, "/repos/octo/repo/branches/renamed", http.StatusMovedPermanently)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	mux.HandleFunc("/repos/octo/repo/commits/abc123/pulls", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"number":1,"head":{"ref":"elsewhere","repo":{"owner":{"login":"someone-else"}}}},
+			{"number":2,"head":{"ref":"moved","repo":{"owner":{"login":"octo"}}}}
+		]`)
+	})
+	mux.HandleFunc("/repos/octo/repo/commits/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+
+	c := newTestClient(t, nil, mux)
+
+	tests := []struct {
+		name   string
+		branch string
+		commit string
+		want   BranchStatus
+	}{
+		{name: "exists", branch: "feature", want: BranchStatus{Exists: true}},
+		{name: "redirected", branch: "old", want: BranchStatus{Exists: true, RenamedTo: "renamed"}},
+		{name: "pull request head moved", branch: "gone", commit: "abc123", want: BranchStatus{Exists: true, RenamedTo: "moved"}},
+		{name: "gone", branch: "gone", commit: "def456", want: BranchStatus{}},
+		{name: "gone without commit", branch: "gone", want: BranchStatus{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			head := Head{Owner: "octo", Repo: "repo", Branch: tt.branch}
+			got, err := c.LookupBranch(context.Background(), head, tt.commit)
+			if err != nil {
+				t.Fatalf("LookupBranch() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("LookupBranch(%s) = %+v, want %+v", tt.branch, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCachedLookupBranchReusesExistence(t *testing.T) {
+	var branchCalls, commitCalls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo/branches/", func(w http.ResponseWriter, r *http.Request) {
+		branchCalls.Add(1)
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/repos/octo/repo/commits/", func(w http.ResponseWriter, r *http.Request) {
+		commitCalls.Add(1)
+		fmt.Fprint(w, `[]`)
+	})
+
+	c := &CachedClient{client: newTestClient(t, nil, mux), cache: openDiskCache(""), ttl: DefaultCacheTTL}
+	head := Head{Owner: "octo", Repo: "repo", Branch: "gone"}
+	ctx := context.Background()
+
+	exists, err := c.BranchExists(ctx, head)
+	if err != nil || exists {
+		t.Fatalf("BranchExists() = %v, %v, want false", exists, err)
+	}
+	for range 2 {
+		status, err := c.LookupBranch(ctx, head, "abc123")
+		if err != nil {
+			t.Fatalf("LookupBranch() error = %v", err)
+		}
+		if status != (BranchStatus{}) {
+			t.Errorf("LookupBranch() = %+v, want not found", status)
+		}
+	}
+
+	if n := branchCalls.Load(); n != 1 {
+		t.Errorf("branch requests = %d, want 1 from BranchExists only", n)
+	}
+	if n := commitCalls.Load(); n != 1 {
+		t.Errorf("pull requests with commit requests = %d, want 1", n)
+	}
+}
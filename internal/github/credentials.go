@@ -0,0 +1,123 @@
+package github
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const credentialHelperTimeout = 5 * time.Second
+
+// ghHost is one entry of the gh CLI hosts.yml file.
+type ghHost struct {
+	User       string `yaml:"user"`
+	OAuthToken string `yaml:"oauth_token"`
+	Users      map[string]struct {
+		OAuthToken string `yaml:"oauth_token"`
+	} `yaml:"users"`
+}
+
+// ghHostsPath returns the location of the gh CLI hosts.yml file, following
+// the same lookup order as gh itself.
+func ghHostsPath() (string, error) {
+	if dir := os.Getenv("GH_CONFIG_DIR"); dir != "" {
+		return filepath.Join(dir, "hosts.yml"), nil
+	}
+
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gh", "hosts.yml"), nil
+	}
+
+	if dir := os.Getenv("AppData"); dir != "" && runtime.GOOS == "windows" {
+		return filepath.Join(dir, "GitHub CLI", "hosts.yml"), nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, ".config", "gh", "hosts.yml"), nil
+}
+
+// readGHCLIToken returns the token the gh CLI stored for host in
+// hosts.yml. Tokens kept in the system keyring are not visible here, so an
+// empty result is not an error.
+func readGHCLIToken(host string) (string, error) {
+	path, err := ghHostsPath()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var hosts map[string]ghHost
+	if err := yaml.Unmarshal(data, &hosts); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	entry, ok := hosts[host]
+	if !ok {
+		return "", nil
+	}
+
+	if entry.OAuthToken != "" {
+		return strings.TrimSpace(entry.OAuthToken), nil
+	}
+
+	if user, ok := entry.Users[entry.User]; ok {
+		return strings.TrimSpace(user.OAuthToken), nil
+	}
+
+	return "", nil
+}
+
+// readGitCredential asks the configured git credential helpers for a
+// password for https://host. Interactive prompts are disabled so a missing
+// credential never blocks startup.
+func readGitCredential(ctx context.Context, host string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, credentialHelperTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=https\nhost=%s\n\n", host))
+	cmd.Env = append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GCM_INTERACTIVE=never",
+		"GIT_ASKPASS=",
+		"SSH_ASKPASS=",
+	)
+
+	output, err := cmd.Output()
+	if err != nil {
+		// git exits non-zero when no helper has a credential and
+		// prompting is disabled; that simply means "not found".
+		return "", nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if password, ok := strings.CutPrefix(scanner.Text(), "password="); ok {
+			return strings.TrimSpace(password), nil
+		}
+	}
+
+	return "", scanner.Err()
+}
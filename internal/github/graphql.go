@@ -0,0 +1,187 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// graphQLBatchSize is the number of branches looked up per GraphQL query.
+// Each branch costs two aliased fields, which keeps a query well inside
+// GitHub's node limits.
+const graphQLBatchSize = 50
+
+// BranchInfo is what GitHub knows about one head branch.
+type BranchInfo struct {
+	PullRequests []PullRequest
+	HeadExists   bool
+}
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type graphQLError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path"`
+}
+
+type graphQLPullRequest struct {
+	Number              int    `json:"number"`
+	Title               string `json:"title"`
+	State               string `json:"state"`
+	IsDraft             bool   `json:"isDraft"`
+	Merged              bool   `json:"merged"`
+	URL                 string `json:"url"`
+	HeadRefName         string `json:"headRefName"`
+	HeadRepositoryOwner *struct {
+		Login string `json:"login"`
+	} `json:"headRepositoryOwner"`
+}
+
+type graphQLBranchResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []graphQLError             `json:"errors"`
+}
+
+type graphQLPullRequests struct {
+	Nodes []graphQLPullRequest `json:"nodes"`
+}
+
+type graphQLHeadRepository struct {
+	Ref *struct {
+		Name string `json:"name"`
+	} `json:"ref"`
+}
+
+// GetBranchInfo looks up pull requests and head ref existence for many
+// heads using a few batched GraphQL queries instead of one REST call per
+// branch. Like GetPullRequestsForBranch, pull requests are looked up in the
+// client's repository and only those opened from each head's owner are
+// returned; head refs are looked up in the head's own repository.
+func (c *Client) GetBranchInfo(ctx context.Context, heads []Head) (map[Head]BranchInfo, error) {
+	result := make(map[Head]BranchInfo, len(heads))
+
+	for start := 0; start < len(heads); start += graphQLBatchSize {
+		end := min(start+graphQLBatchSize, len(heads))
+		if err := c.getBranchInfoBatch(ctx, heads[start:end], result); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func (c *Client) getBranchInfoBatch(ctx context.Context, heads []Head, result map[Head]BranchInfo) error {
+	var query strings.Builder
+	variables := map[string]interface{}{
+		"owner": c.owner,
+		"repo":  c.repo,
+	}
+
+	query.WriteString("query($owner: String!, $repo: String!")
+	for i, head := range heads {
+		fmt.Fprintf(&query, ", $h%d: String!, $r%d: String!, $o%d: String!, $n%d: String!", i, i, i, i)
+		variables[fmt.Sprintf("h%d", i)] = head.Branch
+		variables[fmt.Sprintf("r%d", i)] = "refs/heads/" + head.Branch
+		variables[fmt.Sprintf("o%d", i)] = head.Owner
+		variables[fmt.Sprintf("n%d", i)] = head.Repo
+	}
+	query.WriteString(") {\n  repository(owner: $owner, name: $repo) {\n")
+	for i := range heads {
+		fmt.Fprintf(&query, "    pr%d: pullRequests(headRefName: $h%d, first: 10, orderBy: {field: CREATED_AT, direction: DESC}) {\n", i, i)
+		query.WriteString("      nodes { number title state isDraft merged url headRefName headRepositoryOwner { login } }\n    }\n")
+	}
+	query.WriteString("  }\n")
+	for i := range heads {
+		fmt.Fprintf(&query, "  ref%d: repository(owner: $o%d, name: $n%d) { ref(qualifiedName: $r%d) { name } }\n", i, i, i, i)
+	}
+	query.WriteString("}\n")
+
+	req, err := c.client.NewRequest("POST", c.graphQLURL(), graphQLRequest{
+		Query:     query.String(),
+		Variables: variables,
+	})
+	if err != nil {
+		return err
+	}
+
+	var resp graphQLBranchResponse
+	if _, err := c.client.Do(ctx, req, &resp); err != nil {
+		return err
+	}
+
+	for _, e := range resp.Errors {
+		// A head repository that cannot be resolved, such as a deleted
+		// fork, only means its ref is gone.
+		if len(e.Path) > 0 {
+			if alias, _ := e.Path[0].(string); strings.HasPrefix(alias, "ref") {
+				continue
+			}
+		}
+		return fmt.Errorf("GraphQL query failed: %s", e.Message)
+	}
+
+	var repository map[string]*graphQLPullRequests
+	if err := json.Unmarshal(resp.Data["repository"], &repository); err != nil {
+		return fmt.Errorf("unexpected GraphQL response: %w", err)
+	}
+
+	for i, head := range heads {
+		var info BranchInfo
+
+		// A missing fork repository decodes as null, like a missing ref.
+		var headRepo *graphQLHeadRepository
+		if raw, ok := resp.Data[fmt.Sprintf("ref%d", i)]; ok {
+			if err := json.Unmarshal(raw, &headRepo); err != nil {
+				return fmt.Errorf("unexpected GraphQL response: %w", err)
+			}
+		}
+		info.HeadExists = headRepo != nil && headRepo.Ref != nil
+
+		if prs := repository[fmt.Sprintf("pr%d", i)]; prs != nil {
+			for _, pr := range prs.Nodes {
+				if pr.HeadRepositoryOwner == nil || !strings.EqualFold(pr.HeadRepositoryOwner.Login, head.Owner) {
+					continue
+				}
+				info.PullRequests = append(info.PullRequests, pr.toPullRequest())
+			}
+		}
+
+		result[head] = info
+	}
+
+	return nil
+}
+
+// toPullRequest maps GraphQL states onto the REST representation used by
+// the rest of the client, where a merged pull request is "closed".
+func (pr graphQLPullRequest) toPullRequest() PullRequest {
+	state := strings.ToLower(pr.State)
+	if state == "merged" {
+		state = "closed"
+	}
+
+	return PullRequest{
+		Number: pr.Number,
+		Title:  pr.Title,
+		State:  state,
+		Draft:  pr.IsDraft,
+		Merged: pr.Merged,
+		URL:    pr.URL,
+	}
+}
+
+// graphQLURL returns the GraphQL endpoint for the REST base URL: /graphql
+// on github.com and /api/graphql on GitHub Enterprise Server.
+func (c *Client) graphQLURL() string {
+	base := *c.client.BaseURL
+	if strings.HasSuffix(base.Path, "/api/v3/") {
+		base.Path = strings.TrimSuffix(base.Path, "v3/") + "graphql"
+	} else {
+		base.Path = strings.TrimSuffix(base.Path, "/") + "/graphql"
+	}
+	return base.String()
+}
@@ -0,0 +1,177 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGetBranchInfoBatchesAndMapsStates(t *testing.T) {
+	var queries int
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		queries++
+
+		var req graphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request body: %v", err)
+			return
+		}
+		if req.Variables["owner"] != "octo" || req.Variables["repo"] != "repo" {
+			t.Errorf("variables = %v, want owner octo and repo repo", req.Variables)
+		}
+
+		data := map[string]interface{}{}
+		repository := map[string]interface{}{}
+		for i := 0; ; i++ {
+			head, ok := req.Variables[fmt.Sprintf("h%d", i)].(string)
+			if !ok {
+				break
+			}
+			headOwner := req.Variables[fmt.Sprintf("o%d", i)].(string)
+			ref := map[string]interface{}{"ref": map[string]string{"name": head}}
+
+			var nodes []map[string]interface{}
+			switch head {
+			case "feature/merged":
+				nodes = append(nodes, map[string]interface{}{
+					"number": 7, "title": "Merged work", "state": "MERGED", "merged": true,
+					"url": "https://github.com/octo/repo/pull/7", "headRefName": head,
+					"headRepositoryOwner": map[string]string{"login": "octo"},
+				})
+				ref = map[string]interface{}{"ref": nil}
+			case "feature/draft":
+				nodes = append(nodes,
+					map[string]interface{}{
+						"number": 9, "title": "From a fork", "state": "OPEN",
+						"headRefName": head, "headRepositoryOwner": map[string]string{"login": "someone-else"},
+					},
+					map[string]interface{}{
+						"number": 8, "title": "Draft work", "state": "OPEN", "isDraft": true,
+						"headRefName": head, "headRepositoryOwner": map[string]string{"login": "octo"},
+					})
+			case "feature/gone-fork":
+				ref = nil
+			}
+			if headOwner == "someone-else" && head == "feature/draft" {
+				nodes = nodes[:1]
+			}
+			repository[fmt.Sprintf("pr%d", i)] = map[string]interface{}{"nodes": nodes}
+			data[fmt.Sprintf("ref%d", i)] = ref
+		}
+		data["repository"] = repository
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	})
+
+	c := newTestClient(t, nil, mux)
+
+	fork := Head{Owner: "someone-else", Repo: "repo-fork", Branch: "feature/draft"}
+	goneFork := Head{Owner: "deleted", Repo: "repo", Branch: "feature/gone-fork"}
+	heads := []Head{
+		{Owner: "octo", Repo: "repo", Branch: "feature/merged"},
+		{Owner: "octo", Repo: "repo", Branch: "feature/draft"},
+		fork,
+		goneFork,
+	}
+	for i := 0; i < graphQLBatchSize; i++ {
+		heads = append(heads, Head{Owner: "octo", Repo: "repo", Branch: fmt.Sprintf("topic-%d", i)})
+	}
+
+	infos, err := c.GetBranchInfo(context.Background(), heads)
+	if err != nil {
+		t.Fatalf("GetBranchInfo() error = %v", err)
+	}
+
+	if queries != 2 {
+		t.Errorf("GraphQL queries = %d, want 2", queries)
+	}
+	if len(infos) != len(heads) {
+		t.Errorf("got %d results, want %d", len(infos), len(heads))
+	}
+
+	merged := infos[heads[0]]
+	if merged.HeadExists {
+		t.Error("feature/merged: HeadExists = true, want false")
+	}
+	if len(merged.PullRequests) != 1 || merged.PullRequests[0].State != "closed" || !merged.PullRequests[0].Merged {
+		t.Errorf("feature/merged: PullRequests = %+v, want one merged closed PR", merged.PullRequests)
+	}
+
+	draft := infos[heads[1]]
+	if !draft.HeadExists {
+		t.Error("feature/draft: HeadExists = false, want true")
+	}
+	if len(draft.PullRequests) != 1 || draft.PullRequests[0].Number != 8 || !draft.PullRequests[0].Draft {
+		t.Errorf("feature/draft: PullRequests = %+v, want only draft PR #8", draft.PullRequests)
+	}
+
+	forked := infos[fork]
+	if !forked.HeadExists || len(forked.PullRequests) != 1 || forked.PullRequests[0].Number != 9 {
+		t.Errorf("fork head = %+v, want existing head with PR #9", forked)
+	}
+
+	if gone := infos[goneFork]; gone.HeadExists {
+		t.Errorf("head in missing fork = %+v, want HeadExists false", gone)
+	}
+
+	if other := infos[heads[7]]; !other.HeadExists || len(other.PullRequests) != 0 {
+		t.Errorf("topic-3 = %+v, want existing head without PRs", other)
+	}
+}
+
+func TestGetBranchInfoIgnoresMissingForks(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":{"repository":{"pr0":{"nodes":[]}},"ref0":null},
+			"errors":[{"type":"NOT_FOUND","path":["ref0"],"message":"Could not resolve to a Repository with the name 'deleted/repo'."}]}`)
+	})
+
+	c := newTestClient(t, nil, mux)
+	head := Head{Owner: "deleted", Repo: "repo", Branch: "feature"}
+	infos, err := c.GetBranchInfo(context.Background(), []Head{head})
+	if err != nil {
+		t.Fatalf("GetBranchInfo() error = %v", err)
+	}
+	if infos[head].HeadExists {
+		t.Errorf("HeadExists = true, want false")
+	}
+}
+
+func TestGetBranchInfoReportsGraphQLErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"errors":[{"message":"Could not resolve to a Repository"}]}`)
+	})
+
+	c := newTestClient(t, nil, mux)
+	_, err := c.GetBranchInfo(context.Background(), []Head{{Owner: "octo", Repo: "repo", Branch: "main"}})
+	if err == nil || !strings.Contains(err.Error(), "Could not resolve") {
+		t.Errorf("GetBranchInfo() error = %v, want GraphQL error message", err)
+	}
+}
+
+func TestGraphQLURL(t *testing.T) {
+	tests := map[string]string{
+		"https://api.github.com/":         "https://api.github.com/graphql",
+		"https://ghe.example.com/api/v3/": "https://ghe.example.com/api/graphql",
+		"http://127.0.0.1:8080/":          "http://127.0.0.1:8080/graphql",
+	}
+
+	for base, want := range tests {
+		c := newTestClient(t, nil, http.NewServeMux())
+		baseURL, err := url.Parse(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.client.BaseURL = baseURL
+		if got := c.graphQLURL(); got != want {
+			t.Errorf("graphQLURL() for %s = %s, want %s", base, got, want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v68/github"
+)
+
+const (
+	// defaultMaxRetries is how often a request is retried after a 5xx
+	// answer or a secondary rate limit.
+	defaultMaxRetries = 3
+	// defaultRetryBackoff is the first delay between 5xx retries. It
+	// doubles on every attempt.
+	defaultRetryBackoff = 500 * time.Millisecond
+	// defaultSecondaryBackoff is used when GitHub reports a secondary rate
+	// limit without a Retry-After header, as its docs recommend.
+	defaultSecondaryBackoff = time.Minute
+	// defaultMaxRateLimitWait is the longest the client blocks waiting for
+	// a rate limit to reset. Beyond that, requests fail fast and the
+	// classifier falls back to local git data.
+	defaultMaxRateLimitWait = 2 * time.Minute
+)
+
+// ErrRateLimited is returned without contacting GitHub while the rate
+// limit is exhausted and the reset is too far away to wait for.
+var ErrRateLimited = errors.New("GitHub API rate limit exceeded")
+
+// RateLimitState is the most recent rate-limit information GitHub sent.
+type RateLimitState struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+	// Known is false until a response with rate-limit headers was seen.
+	Known bool
+}
+
+// Exhausted reports whether no requests are left before the reset.
+func (s RateLimitState) Exhausted(now time.Time) bool {
+	return s.Known && s.Remaining == 0 && now.Before(s.Reset)
+}
+
+// Low reports whether less than a tenth of the limit is left.
+func (s RateLimitState) Low() bool {
+	return s.Known && s.Limit > 0 && s.Remaining*10 < s.Limit
+}
+
+func (s RateLimitState) String() string {
+	if !s.Known {
+		return "unknown"
+	}
+	return fmt.Sprintf("%d/%d, resets %s", s.Remaining, s.Limit, s.Reset.Local().Format("15:04"))
+}
+
+// IsRateLimited reports whether err means GitHub refused a request
+// because of a primary or secondary rate limit.
+func IsRateLimited(err error) bool {
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	return errors.Is(err, ErrRateLimited) || errors.As(err, &rateErr) || errors.As(err, &abuseErr)
+}
+
+// rateLimitTransport retries requests GitHub asks us to slow down for and
+// requests that failed with a server error. It tracks the rate limit per
+// resource ("core", "graphql") from response headers.
+type rateLimitTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	backoff    time.Duration
+	maxWait    time.Duration
+
+	// sleep and now are replaced in tests.
+	sleep func(ctx context.Context, d time.Duration) error
+	now   func() time.Time
+
+	mu     sync.Mutex
+	limits map[string]RateLimitState
+}
+
+func newRateLimitTransport(base http.RoundTripper) *rateLimitTransport {
+	return &rateLimitTransport{
+		base:       base,
+		maxRetries: defaultMaxRetries,
+		backoff:    defaultRetryBackoff,
+		maxWait:    defaultMaxRateLimitWait,
+		sleep:      sleepContext,
+		now:        time.Now,
+		limits:     make(map[string]RateLimitState),
+	}
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	resource := requestResource(req)
+
+	if state := t.state(resource); state.Exhausted(t.now()) {
+		wait := state.Reset.Sub(t.now())
+		if wait > t.maxWait {
+			return nil, fmt.Errorf("%w until %s", ErrRateLimited, state.Reset.Local().Format("15:04"))
+		}
+		if err := t.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		attemptReq, err := rewindRequest(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.base.RoundTrip(attemptReq)
+		if err != nil {
+			return nil, err
+		}
+		t.record(resp.Header)
+
+		wait, retry := t.retryDelay(resp, attempt)
+		if !retry || attempt >= t.maxRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+
+		resp.Body.Close()
+		if err := t.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryDelay decides whether resp is worth retrying and how long to wait
+// first.
+func (t *rateLimitTransport) retryDelay(resp *http.Response, attempt int) (time.Duration, bool) {
+	switch {
+	case resp.StatusCode >= 500:
+		return jitter(t.backoff << attempt), true
+
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests:
+		if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+			seconds, err := strconv.Atoi(retryAfter)
+			if err != nil {
+				return 0, false
+			}
+			wait := time.Duration(seconds) * time.Second
+			return wait, wait <= t.maxWait
+		}
+
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			reset, ok := parseUnix(resp.Header.Get("X-RateLimit-Reset"))
+			if !ok {
+				return 0, false
+			}
+			wait := reset.Sub(t.now())
+			return max(wait, 0), wait <= t.maxWait
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests || isSecondaryRateLimit(resp) {
+			wait := defaultSecondaryBackoff << attempt
+			return wait, wait <= t.maxWait
+		}
+	}
+
+	return 0, false
+}
+
+// isSecondaryRateLimit reports whether a 403 answer is GitHub's secondary
+// rate limit rather than a permission problem. The body is left readable.
+func isSecondaryRateLimit(resp *http.Response) bool {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	return bytes.Contains(bytes.ToLower(body), []byte("secondary rate limit"))
+}
+
+func (t *rateLimitTransport) record(h http.Header) {
+	limit, err := strconv.Atoi(h.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return
+	}
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, _ := parseUnix(h.Get("X-RateLimit-Reset"))
+
+	resource := h.Get("X-RateLimit-Resource")
+	if resource == "" {
+		resource = "core"
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.limits[resource] = RateLimitState{Limit: limit, Remaining: remaining, Reset: reset, Known: true}
+}
+
+func (t *rateLimitTransport) state(resource string) RateLimitState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limits[resource]
+}
+
+// requestResource guesses which rate limit a request counts against.
+func requestResource(req *http.Request) string {
+	if strings.HasSuffix(req.URL.Path, "/graphql") {
+		return "graphql"
+	}
+	return "core"
+}
+
+// rewindRequest returns req for the first attempt and a copy with a fresh
+// body for retries.
+func rewindRequest(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 0 || req.Body == nil || req.GetBody == nil {
+		return req, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	clone := req.Clone(req.Context())
+	clone.Body = body
+	return clone, nil
+}
+
+func parseUnix(s string) (time.Time, bool) {
+	secs, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(secs, 0), true
+}
+
+// jitter returns a random duration in [d/2, d), so clients that failed
+// together do not retry together.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	half := d / 2
+	return half + rand.N(half)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,265 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v68/github"
+)
+
+// newRateLimitTestClient returns a Client for octo/repo that talks to
+// handler through a rateLimitTransport whose sleeps are recorded instead
+// of taken.
+func newRateLimitTestClient(t *testing.T, handler http.Handler) (*Client, *rateLimitTransport, *[]time.Duration) {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	var slept []time.Duration
+	transport := newRateLimitTransport(http.DefaultTransport)
+	transport.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+
+	client := github.NewClient(&http.Client{Transport: transport})
+	baseURL, err := client.BaseURL.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = baseURL
+
+	c := &Client{client: client, auth: NewAuthConfig(), owner: "octo", repo: "repo", limits: transport}
+	return c, transport, &slept
+}
+
+func setRateHeaders(w http.ResponseWriter, remaining int, reset time.Time) {
+	w.Header().Set("X-RateLimit-Limit", "5000")
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	w.Header().Set("X-RateLimit-Resource", "core")
+}
+
+func TestRateLimitTransportRetriesServerErrors(t *testing.T) {
+	var calls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, `[{"number":1,"state":"open"}]`)
+	})
+
+	c, _, slept := newRateLimitTestClient(t, mux)
+	prs, err := c.GetPullRequestsForBranch(context.Background(), featureHead)
+	if err != nil {
+		t.Fatalf("GetPullRequestsForBranch() error = %v", err)
+	}
+	if len(prs) != 1 {
+		t.Errorf("got %d PRs, want 1", len(prs))
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+
+	if len(*slept) != 2 {
+		t.Fatalf("slept %v, want two back-offs", *slept)
+	}
+	for i, d := range *slept {
+		base := defaultRetryBackoff << i
+		if d < base/2 || d >= base {
+			t.Errorf("back-off %d = %v, want in [%v, %v)", i, d, base/2, base)
+		}
+	}
+}
+
+func TestRateLimitTransportGivesUpAfterMaxRetries(t *testing.T) {
+	var calls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	c, _, _ := newRateLimitTestClient(t, mux)
+	if _, err := c.GetPullRequestsForBranch(context.Background(), featureHead); err == nil {
+		t.Error("GetPullRequestsForBranch() error = nil, want 503")
+	}
+	if calls != defaultMaxRetries+1 {
+		t.Errorf("calls = %d, want %d", calls, defaultMaxRetries+1)
+	}
+}
+
+func TestRateLimitTransportRetriesPostBody(t *testing.T) {
+	var calls int
+	var bodies []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"repository":{"ref0":null,"pr0":{"nodes":[]}}}}`)
+	})
+
+	c, _, _ := newRateLimitTestClient(t, mux)
+	if _, err := c.GetBranchInfo(context.Background(), []Head{featureHead}); err != nil {
+		t.Fatalf("GetBranchInfo() error = %v", err)
+	}
+	if len(bodies) != 2 || bodies[0] != bodies[1] || bodies[1] == "" {
+		t.Errorf("retried body differs or is empty: %q", bodies)
+	}
+}
+
+func TestRateLimitTransportHonorsRetryAfter(t *testing.T) {
+	var calls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo/branches/feature", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message":"You have exceeded a secondary rate limit."}`)
+			return
+		}
+		fmt.Fprint(w, `{"name":"feature"}`)
+	})
+
+	c, _, slept := newRateLimitTestClient(t, mux)
+	exists, err := c.BranchExists(context.Background(), featureHead)
+	if err != nil || !exists {
+		t.Fatalf("BranchExists() = %v, %v; want true, nil", exists, err)
+	}
+	if len(*slept) != 1 || (*slept)[0] != 7*time.Second {
+		t.Errorf("slept %v, want [7s]", *slept)
+	}
+}
+
+func TestRateLimitTransportSecondaryLimitWithoutRetryAfter(t *testing.T) {
+	var calls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo/branches/feature", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message":"You have exceeded a secondary rate limit."}`)
+			return
+		}
+		fmt.Fprint(w, `{"name":"feature"}`)
+	})
+
+	c, _, slept := newRateLimitTestClient(t, mux)
+	if _, err := c.BranchExists(context.Background(), featureHead); err != nil {
+		t.Fatalf("BranchExists() error = %v", err)
+	}
+	if len(*slept) != 1 || (*slept)[0] != defaultSecondaryBackoff {
+		t.Errorf("slept %v, want [%v]", *slept, defaultSecondaryBackoff)
+	}
+}
+
+func TestRateLimitTransportDoesNotRetryPermissionErrors(t *testing.T) {
+	var calls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo/branches/feature", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message":"Resource not accessible by integration"}`)
+	})
+
+	c, _, _ := newRateLimitTestClient(t, mux)
+	if _, err := c.BranchExists(context.Background(), featureHead); err == nil || IsRateLimited(err) {
+		t.Errorf("BranchExists() error = %v, want permission error", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestRateLimitTransportWaitsForPrimaryReset(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	reset := now.Add(30 * time.Second)
+
+	var calls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo/branches/feature", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			setRateHeaders(w, 0, reset)
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message":"API rate limit exceeded"}`)
+			return
+		}
+		setRateHeaders(w, 4999, reset.Add(time.Hour))
+		fmt.Fprint(w, `{"name":"feature"}`)
+	})
+
+	c, transport, slept := newRateLimitTestClient(t, mux)
+	transport.now = func() time.Time { return now }
+
+	if _, err := c.BranchExists(context.Background(), featureHead); err != nil {
+		t.Fatalf("BranchExists() error = %v", err)
+	}
+	if len(*slept) != 1 || (*slept)[0] != 30*time.Second {
+		t.Errorf("slept %v, want [30s]", *slept)
+	}
+
+	state, err := c.GetRateLimit(context.Background())
+	if err != nil {
+		t.Fatalf("GetRateLimit() error = %v", err)
+	}
+	if state.Remaining != 4999 || state.Limit != 5000 {
+		t.Errorf("GetRateLimit() = %+v, want 4999/5000", state)
+	}
+}
+
+func TestRateLimitTransportDegradesWhenResetIsFar(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	reset := now.Add(time.Hour)
+
+	var calls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		setRateHeaders(w, 0, reset)
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message":"API rate limit exceeded"}`)
+	})
+
+	c, transport, slept := newRateLimitTestClient(t, mux)
+	transport.now = func() time.Time { return now }
+
+	_, err := c.GetPullRequestsForBranch(context.Background(), featureHead)
+	if !IsRateLimited(err) {
+		t.Errorf("GetPullRequestsForBranch() error = %v, want rate-limit error", err)
+	}
+	if calls != 1 || len(*slept) != 0 {
+		t.Errorf("calls = %d, slept %v; want one call and no waiting", calls, *slept)
+	}
+
+	// Later requests fail fast without reaching the server.
+	req, _ := http.NewRequest(http.MethodGet, c.client.BaseURL.String()+"repos/octo/repo/pulls", nil)
+	if _, err := transport.RoundTrip(req); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("RoundTrip() error = %v, want %v", err, ErrRateLimited)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d after exhaustion, want 1", calls)
+	}
+
+	state, _ := c.GetRateLimit(context.Background())
+	if !state.Exhausted(now) {
+		t.Errorf("GetRateLimit() = %+v, want exhausted", state)
+	}
+}
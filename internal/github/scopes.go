@@ -0,0 +1,141 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v68/github"
+)
+
+// RequiredScopes are the classic OAuth scopes branch-wrangler needs to
+// read pull requests and branches.
+var RequiredScopes = []string{"repo"}
+
+// TokenInfo describes the active token: where it came from, what kind it
+// is and which permissions it lacks for the current repository.
+type TokenInfo struct {
+	Source  TokenSource `json:"source"`
+	Type    string      `json:"type"`
+	Scopes  []string    `json:"scopes"`
+	Missing []string    `json:"missing,omitempty"`
+
+	// env is the environment variable read for SourceEnv.
+	env string
+}
+
+// Summary returns a one-line description for headers and logs.
+func (t *TokenInfo) Summary() string {
+	summary := describeSource(t.Source, t.env) + " token"
+	if len(t.Scopes) > 0 {
+		summary += " (" + strings.Join(t.Scopes, ", ") + ")"
+	}
+	return summary
+}
+
+// MissingSummary describes missing permissions, or returns "" when the
+// token has everything it needs.
+func (t *TokenInfo) MissingSummary() string {
+	if len(t.Missing) == 0 {
+		return ""
+	}
+	return "token is missing " + strings.Join(t.Missing, ", ") + " - pull request states will be incomplete"
+}
+
+// tokenType infers the kind of token from its prefix.
+func tokenType(token string) string {
+	switch {
+	case strings.HasPrefix(token, "github_pat_"):
+		return "fine_grained"
+	case strings.HasPrefix(token, "ghp_"):
+		return "classic"
+	case strings.HasPrefix(token, "gho_"):
+		return "oauth"
+	case strings.HasPrefix(token, "ghu_"), strings.HasPrefix(token, "ghs_"):
+		return "github_app"
+	default:
+		return "unknown"
+	}
+}
+
+// parseScopes reads the X-OAuth-Scopes header. The second result is false
+// when the header is absent, as it is for fine-grained and app tokens.
+func parseScopes(header http.Header) ([]string, bool) {
+	if _, ok := header[http.CanonicalHeaderKey("X-OAuth-Scopes")]; !ok {
+		return nil, false
+	}
+
+	scopes := []string{}
+	for _, scope := range strings.Split(header.Get("X-OAuth-Scopes"), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, true
+}
+
+func hasScope(scopes []string, want string) bool {
+	for _, scope := range scopes {
+		if scope == want {
+			return true
+		}
+	}
+	return false
+}
+
+// inspectToken works out which permissions the token lacks for the
+// repository. Classic and OAuth tokens are checked against their scopes;
+// tokens without a scope header are probed with read requests.
+func (c *Client) inspectToken(ctx context.Context, token string) *TokenInfo {
+	info := &TokenInfo{
+		Source: c.auth.Source,
+		Type:   tokenType(token),
+		Scopes: c.auth.scopes,
+		env:    c.auth.TokenEnv,
+	}
+	if info.Scopes == nil {
+		info.Scopes = []string{}
+	}
+
+	if c.auth.scopesKnown {
+		for _, scope := range RequiredScopes {
+			if hasScope(info.Scopes, scope) {
+				continue
+			}
+			if scope == "repo" && hasScope(info.Scopes, "public_repo") && c.isPublicRepo(ctx) {
+				continue
+			}
+			info.Missing = append(info.Missing, scope)
+		}
+		return info
+	}
+
+	if _, _, err := c.client.Repositories.ListBranches(ctx, c.owner, c.repo,
+		&github.BranchListOptions{ListOptions: github.ListOptions{PerPage: 1}}); isPermissionError(err) {
+		info.Missing = append(info.Missing, "contents: read")
+	}
+
+	if _, _, err := c.client.PullRequests.List(ctx, c.owner, c.repo,
+		&github.PullRequestListOptions{State: "all", ListOptions: github.ListOptions{PerPage: 1}}); isPermissionError(err) {
+		info.Missing = append(info.Missing, "pull_requests: read")
+	}
+
+	return info
+}
+
+func (c *Client) isPublicRepo(ctx context.Context) bool {
+	repo, _, err := c.client.Repositories.Get(ctx, c.owner, c.repo)
+	return err == nil && !repo.GetPrivate()
+}
+
+// isPermissionError reports whether err is a 403, or a 404 that GitHub
+// returns instead of 403 for repositories the token cannot see.
+func isPermissionError(err error) bool {
+	var ghErr *github.ErrorResponse
+	if !errors.As(err, &ghErr) || ghErr.Response == nil {
+		return false
+	}
+	code := ghErr.Response.StatusCode
+	return code == http.StatusForbidden || code == http.StatusNotFound
+}
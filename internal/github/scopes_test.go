@@ -0,0 +1,126 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v68/github"
+)
+
+// featureHead is a branch in the test repository octo/repo.
+var featureHead = Head{Owner: "octo", Repo: "repo", Branch: "feature"}
+
+// newTestClient returns a Client for octo/repo whose API requests go to
+// handler.
+func newTestClient(t *testing.T, auth *AuthConfig, handler http.Handler) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BaseURL = baseURL
+
+	if auth == nil {
+		auth = NewAuthConfig()
+	}
+
+	return &Client{client: client, auth: auth, owner: "octo", repo: "repo"}
+}
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    http.Header
+		want      []string
+		wantKnown bool
+	}{
+		{name: "absent", header: http.Header{}, want: nil, wantKnown: false},
+		{name: "empty", header: http.Header{"X-Oauth-Scopes": {""}}, want: []string{}, wantKnown: true},
+		{name: "several", header: http.Header{"X-Oauth-Scopes": {"repo, workflow,read:org"}}, want: []string{"repo", "workflow", "read:org"}, wantKnown: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, known := parseScopes(tt.header)
+			if known != tt.wantKnown || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseScopes() = %v, %v; want %v, %v", got, known, tt.want, tt.wantKnown)
+			}
+		})
+	}
+}
+
+func TestInspectTokenClassicMissingRepo(t *testing.T) {
+	auth := NewAuthConfig()
+	auth.Source = SourceEnv
+	auth.scopes, auth.scopesKnown = []string{"public_repo"}, true
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name":"repo","private":true}`)
+	})
+
+	c := newTestClient(t, auth, mux)
+	info := c.inspectToken(context.Background(), "ghp_example")
+
+	if info.Type != "classic" {
+		t.Errorf("Type = %q, want classic", info.Type)
+	}
+	if !reflect.DeepEqual(info.Missing, []string{"repo"}) {
+		t.Errorf("Missing = %v, want [repo]", info.Missing)
+	}
+	if info.MissingSummary() == "" {
+		t.Error("MissingSummary() should describe the missing scope")
+	}
+}
+
+func TestInspectTokenPublicRepoScopeOnPublicRepo(t *testing.T) {
+	auth := NewAuthConfig()
+	auth.scopes, auth.scopesKnown = []string{"public_repo"}, true
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name":"repo","private":false}`)
+	})
+
+	c := newTestClient(t, auth, mux)
+	if info := c.inspectToken(context.Background(), "gho_example"); len(info.Missing) != 0 {
+		t.Errorf("Missing = %v, want none", info.Missing)
+	}
+}
+
+func TestInspectTokenFineGrainedProbes(t *testing.T) {
+	auth := NewAuthConfig()
+	auth.Source = SourceConfig
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo/branches", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/repos/octo/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message":"Resource not accessible by personal access token"}`)
+	})
+
+	c := newTestClient(t, auth, mux)
+	info := c.inspectToken(context.Background(), "github_pat_example")
+
+	if info.Type != "fine_grained" {
+		t.Errorf("Type = %q, want fine_grained", info.Type)
+	}
+	if !reflect.DeepEqual(info.Missing, []string{"pull_requests: read"}) {
+		t.Errorf("Missing = %v, want [pull_requests: read]", info.Missing)
+	}
+	if info.Source != SourceConfig {
+		t.Errorf("Source = %q, want %q", info.Source, SourceConfig)
+	}
+}
@@ -48,6 +48,13 @@ func (m Model) handleActionKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			return m, m.openPR(selectedBranch.PRURL)
 		}
 		return m, nil
+	case "t":
+		if selectedBranch.State == git.RemoteRenamed && selectedBranch.RenamedTo != "" {
+			return m, m.createConfirmation("retarget", selectedBranch.Name,
+				fmt.Sprintf("Branch '%s' tracks '%s', which was renamed to '%s/%s'. Track the new name?",
+					selectedBranch.Name, selectedBranch.TrackingRef, selectedBranch.UpstreamRemote, selectedBranch.RenamedTo), false)
+		}
+		return m, nil
 	case "u":
 		return m, m.showUndoView()
 	}
@@ -85,6 +92,32 @@ func (m Model) deleteBranch(branchName string, force bool) tea.Cmd {
 	}
 }
 
+// retargetUpstream fetches the renamed remote branch and makes it the
+// branch's upstream.
+func (m Model) retargetUpstream(branchName string) tea.Cmd {
+	var branch git.Branch
+	for _, b := range m.branches {
+		if b.Name == branchName {
+			branch = b
+			break
+		}
+	}
+
+	return func() tea.Msg {
+		remote, newName := branch.UpstreamRemote, branch.RenamedTo
+		err := exec.Command("git", "fetch", "--quiet", remote,
+			fmt.Sprintf("+refs/heads/%s:refs/remotes/%s/%s", newName, remote, newName)).Run()
+		if err == nil {
+			err = exec.Command("git", "branch", "--set-upstream-to="+remote+"/"+newName, branchName).Run()
+		}
+		return ActionMsg{
+			Action: "retarget",
+			Branch: branchName,
+			Error:  err,
+		}
+	}
+}
+
 func (m Model) openPR(url string) tea.Cmd {
 	return func() tea.Msg {
 		var cmd *exec.Cmd
@@ -42,6 +42,8 @@ func (m Model) handleConfirmKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			return m, m.deleteBranch(m.confirmation.Branch, false)
 		case "force-delete":
 			return m, m.deleteBranch(m.confirmation.Branch, true)
+		case "retarget":
+			return m, m.retargetUpstream(m.confirmation.Branch)
 		}
 		return m, nil
 	case "n", "escape":
@@ -0,0 +1,65 @@
+package ui
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// detachedView is the modal shown when HEAD is not on a branch. It explains
+// the risk and offers to check out the default branch.
+func (m Model) detachedView() string {
+	warnColor := lipgloss.Color("11") // Yellow
+
+	content := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(warnColor).
+		Render("HEAD is detached") + "\n\n"
+
+	content += fmt.Sprintf("HEAD points at %.12s %s\n\n", m.status.HeadCommit, m.status.HeadSubject)
+	content += "You are not on any branch. New commits made here belong to no\n"
+	content += "branch and are easy to lose when you switch away; only the reflog\n"
+	content += "would still find them. Branches below are classified as usual.\n\n"
+
+	defaultBranch := m.classifier.DefaultBranch(m.ctx)
+	switch {
+	case m.status.Operation != "":
+		content += fmt.Sprintf("A %s is in progress. Finish or abort it with git before\n", m.status.Operation)
+		content += "switching branches.\n\n"
+		content += "Press s or Esc to stay"
+	case defaultBranch != "":
+		content += fmt.Sprintf("Press c to check out %s, s or Esc to stay", defaultBranch)
+	default:
+		content += "Press s or Esc to stay"
+	}
+
+	return lipgloss.NewStyle().
+		Width(m.width).
+		Height(m.height).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(warnColor).
+		Padding(2).
+		Margin(2).
+		Render(content)
+}
+
+func (m Model) handleDetachedKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "c":
+		if m.status.Operation != "" {
+			return m, nil
+		}
+		if branch := m.classifier.DefaultBranch(m.ctx); branch != "" {
+			m.showDetached = false
+			m.detachedDismissed = true
+			return m, m.checkoutBranch(branch)
+		}
+	case "s", "esc", "escape":
+		m.showDetached = false
+		m.detachedDismissed = true
+	case "ctrl+c", "q":
+		return m, tea.Quit
+	}
+	return m, nil
+}
@@ -13,11 +13,13 @@ const (
 	FilterByState
 	FilterBySearch
 	FilterByCustom
+	FilterByFlag
 )
 
 type Filter struct {
 	Mode       FilterMode
 	States     []git.BranchState
+	Flags      []git.BranchFlag
 	SearchTerm string
 	CustomName string
 	IsActive   bool
@@ -57,6 +59,18 @@ func (f *Filter) matches(branch git.Branch) bool {
 		return f.matchesSearch(branch.Name)
 	case FilterByCustom:
 		return f.matchesState(branch.State) || f.matchesSearch(branch.Name)
+	case FilterByFlag:
+		return f.matchesFlags(branch)
+	}
+	return true
+}
+
+// matchesFlags reports whether the branch has every flag in the filter.
+func (f *Filter) matchesFlags(branch git.Branch) bool {
+	for _, flag := range f.Flags {
+		if !branch.HasFlag(flag) {
+			return false
+		}
 	}
 	return true
 }
@@ -89,6 +103,15 @@ func (f *Filter) SetStateFilter(states []git.BranchState) {
 	f.SearchTerm = ""
 }
 
+// SetFlagFilter shows branches that have all of flags, whatever their
+// primary state.
+func (f *Filter) SetFlagFilter(flags []git.BranchFlag) {
+	f.Mode = FilterByFlag
+	f.Flags = flags
+	f.IsActive = true
+	f.SearchTerm = ""
+}
+
 func (f *Filter) SetSearchFilter(term string) {
 	f.Mode = FilterBySearch
 	f.SearchTerm = term
@@ -107,6 +130,7 @@ func (f *Filter) SetCustomFilter(name string, states []git.BranchState, searchTe
 func (f *Filter) Clear() {
 	f.Mode = FilterAll
 	f.States = []git.BranchState{}
+	f.Flags = nil
 	f.SearchTerm = ""
 	f.CustomName = ""
 	f.IsActive = false
@@ -125,8 +149,11 @@ func (f *Filter) DisplayName() string {
 		return "Multiple States"
 	case FilterBySearch:
 		return "Search: " + f.SearchTerm
-	case FilterByCustom:
-		return f.CustomName
+	case FilterByCustom, FilterByFlag:
+		if f.CustomName != "" {
+			return f.CustomName
+		}
+		return "Flagged"
 	}
 
 	return "All Branches"
@@ -152,9 +179,27 @@ var PredefinedFilters = map[string]Filter{
 		CustomName: "Merged Branches",
 	},
 	"Ahead": {
-		Mode:       FilterByState,
-		States:     []git.BranchState{git.UnpushedAhead, git.Diverged},
+		Mode:       FilterByFlag,
+		Flags:      []git.BranchFlag{git.FlagAhead},
 		IsActive:   true,
 		CustomName: "Ahead of Remote",
 	},
+	"Behind": {
+		Mode:       FilterByFlag,
+		Flags:      []git.BranchFlag{git.FlagBehind},
+		IsActive:   true,
+		CustomName: "Behind Remote",
+	},
+	"Old": {
+		Mode:       FilterByFlag,
+		Flags:      []git.BranchFlag{git.FlagStaleByAge},
+		IsActive:   true,
+		CustomName: "No Recent Commits",
+	},
+	"Upstream Missing": {
+		Mode:       FilterByFlag,
+		Flags:      []git.BranchFlag{git.FlagUpstreamMissing},
+		IsActive:   true,
+		CustomName: "Upstream Missing",
+	},
 }
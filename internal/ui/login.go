@@ -0,0 +1,141 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/dfinster/branch-wrangler/internal/github"
+)
+
+// LoginModel runs the GitHub OAuth device flow inside the TUI.
+type LoginModel struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	auth   *github.AuthConfig
+	code   *github.DeviceCode
+	token  string
+	err    error
+	width  int
+	height int
+}
+
+type deviceCodeMsg struct {
+	code *github.DeviceCode
+	err  error
+}
+
+type deviceTokenMsg struct {
+	token string
+	err   error
+}
+
+func NewLoginModel(ctx context.Context, auth *github.AuthConfig) LoginModel {
+	ctx, cancel := context.WithCancel(ctx)
+	return LoginModel{
+		ctx:    ctx,
+		cancel: cancel,
+		auth:   auth,
+	}
+}
+
+// RunLogin shows the device flow login screen until the user authorizes
+// the app or cancels, then saves the token.
+func RunLogin(ctx context.Context, auth *github.AuthConfig) (string, error) {
+	p := tea.NewProgram(NewLoginModel(ctx, auth), tea.WithAltScreen())
+	final, err := p.Run()
+	if err != nil {
+		return "", err
+	}
+
+	m := final.(LoginModel)
+	if m.err != nil {
+		return "", m.err
+	}
+
+	auth.Token = m.token
+	auth.Source = github.SourceDeviceFlow
+	if err := auth.SaveToken(m.token); err != nil {
+		return m.token, fmt.Errorf("logged in, but failed to save token: %w", err)
+	}
+
+	return m.token, nil
+}
+
+func (m LoginModel) Init() tea.Cmd {
+	return func() tea.Msg {
+		code, err := m.auth.RequestDeviceCode(m.ctx)
+		return deviceCodeMsg{code: code, err: err}
+	}
+}
+
+func (m LoginModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		return m, nil
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			m.cancel()
+			if m.err == nil {
+				m.err = fmt.Errorf("login cancelled")
+			}
+			return m, tea.Quit
+		}
+
+	case deviceCodeMsg:
+		if msg.err != nil {
+			m.err = msg.err
+			return m, tea.Quit
+		}
+		m.code = msg.code
+		return m, m.pollForToken()
+
+	case deviceTokenMsg:
+		m.cancel()
+		m.token = msg.token
+		m.err = msg.err
+		return m, tea.Quit
+	}
+
+	return m, nil
+}
+
+func (m LoginModel) pollForToken() tea.Cmd {
+	code := m.code
+	return func() tea.Msg {
+		token, err := m.auth.PollForToken(m.ctx, code)
+		return deviceTokenMsg{token: token, err: err}
+	}
+}
+
+func (m LoginModel) View() string {
+	title := lipgloss.NewStyle().Bold(true).Render("Sign in to GitHub")
+
+	var content string
+	switch {
+	case m.err != nil:
+		content = "Error: " + m.err.Error()
+	case m.code == nil:
+		content = "Requesting a login code from GitHub..."
+	default:
+		content = "Open " + m.code.VerificationURI + " in your browser\n"
+		content += "and enter this code:\n\n"
+		content += lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("11")).Render(m.code.UserCode) + "\n\n"
+		content += "Waiting for authorization..."
+	}
+
+	content = title + "\n\n" + content + "\n\nPress q to cancel"
+
+	return lipgloss.NewStyle().
+		Width(m.width).
+		Height(m.height).
+		Border(lipgloss.RoundedBorder()).
+		Padding(2).
+		Render(content)
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 
 	"github.com/dfinster/branch-wrangler/internal/git"
+	"github.com/dfinster/branch-wrangler/internal/github"
 )
 
 type Model struct {
@@ -21,22 +23,30 @@ type Model struct {
 	showHelp          bool
 	showFilter        bool
 	showConfirmDialog bool
+	showExplain       bool
+	showDetached      bool
+	detachedDismissed bool
 	filter            *Filter
 	searchInput       string
 	ctx               context.Context
 	classifier        *git.Classifier
+	githubClient      *github.CachedClient
 	loading           bool
 	err               error
 	lastAction        string
 	confirmation      ConfirmationMsg
+	rateLimit         github.RateLimitState
+	status            git.GitStatus
 }
 
 type LoadBranchesMsg struct {
-	branches []git.Branch
-	err      error
+	branches  []git.Branch
+	err       error
+	rateLimit github.RateLimitState
+	status    git.GitStatus
 }
 
-func NewModel(ctx context.Context, classifier *git.Classifier) Model {
+func NewModel(ctx context.Context, classifier *git.Classifier, githubClient *github.CachedClient) Model {
 	return Model{
 		branches:         []git.Branch{},
 		filteredBranches: []git.Branch{},
@@ -44,6 +54,7 @@ func NewModel(ctx context.Context, classifier *git.Classifier) Model {
 		selectedBranches: make(map[int]bool),
 		ctx:              ctx,
 		classifier:       classifier,
+		githubClient:     githubClient,
 		loading:          true,
 		filter:           NewFilter(),
 	}
@@ -69,6 +80,10 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.handleConfirmKeys(msg)
 		}
 
+		if m.showDetached {
+			return m.handleDetachedKeys(msg)
+		}
+
 		// Handle action keys first
 		if newModel, cmd := m.handleActionKeys(msg); cmd != nil {
 			return newModel, cmd
@@ -87,6 +102,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		case "?":
 			m.showHelp = !m.showHelp
+		case "e":
+			m.showExplain = !m.showExplain
 		case "r":
 			m.loading = true
 			return m, m.loadBranches()
@@ -118,6 +135,21 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.filter = &filter
 				m.updateFilteredBranches()
 			}
+		case "5":
+			if filter, ok := PredefinedFilters["Behind"]; ok {
+				m.filter = &filter
+				m.updateFilteredBranches()
+			}
+		case "6":
+			if filter, ok := PredefinedFilters["Old"]; ok {
+				m.filter = &filter
+				m.updateFilteredBranches()
+			}
+		case "7":
+			if filter, ok := PredefinedFilters["Upstream Missing"]; ok {
+				m.filter = &filter
+				m.updateFilteredBranches()
+			}
 		case "space":
 			if _, exists := m.selectedBranches[m.selected]; exists {
 				delete(m.selectedBranches, m.selected)
@@ -128,6 +160,10 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case LoadBranchesMsg:
 		m.loading = false
+		m.rateLimit = msg.rateLimit
+		m.status = msg.status
+		// Ask once per session; after "stay" the header keeps reminding.
+		m.showDetached = msg.status.IsDetached && !m.detachedDismissed
 		if msg.err != nil {
 			m.err = msg.err
 		} else {
@@ -177,6 +213,10 @@ func (m Model) View() string {
 		return m.confirmationView()
 	}
 
+	if m.showDetached {
+		return m.detachedView()
+	}
+
 	header := m.headerView()
 	leftPane := m.branchListView()
 	rightPane := m.branchDetailsView()
@@ -241,10 +281,22 @@ func (m Model) branchDetailsView() string {
 		content = "No branch selected"
 	} else {
 		branch := m.filteredBranches[m.selected]
+		if m.showExplain {
+			return m.explainView(branch)
+		}
 		content = "Branch: " + branch.Name + "\n"
 		content += "State: " + branch.State.DisplayName() + "\n"
 		content += "Last Commit: " + branch.LastCommit.Format("2006-01-02 15:04:05") + "\n"
 		content += "Author: " + branch.Author + "\n"
+		if branch.TrackingRef != "" {
+			content += "Upstream: " + branch.TrackingRef + "\n"
+		}
+		if branch.RenamedTo != "" {
+			content += "Renamed to: " + branch.UpstreamRemote + "/" + branch.RenamedTo + " (t to track)\n"
+		}
+		if branch.PushRef != "" {
+			content += "Push: " + branch.PushRef + "\n"
+		}
 
 		if branch.Ahead > 0 {
 			content += "Ahead: " + strconv.Itoa(branch.Ahead) + "\n"
@@ -258,6 +310,12 @@ func (m Model) branchDetailsView() string {
 		if branch.PRURL != "" {
 			content += "URL: " + branch.PRURL + "\n"
 		}
+		if len(branch.Flags) > 0 {
+			content += "Flags: " + flagsView(branch.Flags) + "\n"
+		}
+		if branch.MergedInto != "" {
+			content += "Merged into: " + branch.MergedInto + mergedByView(branch) + "\n"
+		}
 	}
 
 	return lipgloss.NewStyle().
@@ -268,6 +326,21 @@ func (m Model) branchDetailsView() string {
 		Render(content)
 }
 
+// explainView replaces the details pane with how the branch was
+// classified.
+func (m Model) explainView(branch git.Branch) string {
+	content := "Why " + branch.Name + " is " + branch.State.DisplayName() + ":\n\n"
+	content += git.FormatTrace(branch)
+	content += "\nPress e to return to details"
+
+	return lipgloss.NewStyle().
+		Width(m.width / 2).
+		Height(m.height - 3).
+		Border(lipgloss.NormalBorder()).
+		Padding(1).
+		Render(content)
+}
+
 func (m Model) helpView() string {
 	help := `Branch Wrangler Help
 
@@ -275,6 +348,7 @@ Navigation:
   ↑/k     Move up
   ↓/j     Move down
   r       Refresh branches
+  e       Explain classification
   ?       Toggle help
   q       Quit
 
@@ -286,6 +360,9 @@ Filtering:
   2       PR branches
   3       Merged branches
   4       Ahead branches
+  5       Behind branches
+  6       No recent commits
+  7       Upstream missing
 
 Actions:
   space   Select/unselect branch
@@ -293,6 +370,7 @@ Actions:
   d       Delete branch (safe)
   D       Force delete branch
   o       Open PR in browser
+  t       Track renamed remote branch
   u       Undo (coming soon)
 
 Press ? to close help`
@@ -308,6 +386,32 @@ Press ? to close help`
 func (m Model) loadBranches() tea.Cmd {
 	return func() tea.Msg {
 		branches, err := m.classifier.ClassifyAllBranches(m.ctx)
-		return LoadBranchesMsg{branches: branches, err: err}
+		msg := LoadBranchesMsg{branches: branches, err: err}
+		msg.status, _ = m.classifier.Status()
+		if m.githubClient != nil {
+			msg.rateLimit, _ = m.githubClient.GetRateLimit(m.ctx)
+		}
+		return msg
+	}
+}
+
+// mergedByView describes how a branch reached its base, naming the base
+// commit that absorbed a squashed or rebased branch.
+func mergedByView(branch git.Branch) string {
+	switch {
+	case branch.MergedBy != "":
+		return fmt.Sprintf(" by %.12s (%s)", branch.MergedBy, branch.MergeMethod)
+	case branch.MergeMethod != "":
+		return " (" + branch.MergeMethod + ")"
+	default:
+		return ""
+	}
+}
+
+func flagsView(flags []git.BranchFlag) string {
+	names := make([]string, len(flags))
+	for i, flag := range flags {
+		names[i] = string(flag)
 	}
+	return strings.Join(names, ", ")
 }
@@ -0,0 +1,251 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/dfinster/branch-wrangler/internal/git"
+	"github.com/dfinster/branch-wrangler/internal/github"
+)
+
+// offlineGitHub answers as GitHub would when it cannot be reached, so the
+// classifier relies on git alone.
+type offlineGitHub struct{}
+
+var errOffline = errors.New("offline")
+
+func (offlineGitHub) PrefetchBranches(ctx context.Context, heads []github.Head) error {
+	return errOffline
+}
+
+func (offlineGitHub) GetPullRequestsForBranch(ctx context.Context, head github.Head) ([]github.PullRequest, error) {
+	return nil, errOffline
+}
+
+func (offlineGitHub) BranchExists(ctx context.Context, head github.Head) (bool, error) {
+	return false, errOffline
+}
+
+func (offlineGitHub) LookupBranch(ctx context.Context, head github.Head, commit string) (github.BranchStatus, error) {
+	return github.BranchStatus{}, errOffline
+}
+
+func (offlineGitHub) DefaultBranch(ctx context.Context) (string, error) {
+	return "", errOffline
+}
+
+func (offlineGitHub) SaveCache() error {
+	return nil
+}
+
+// runGit runs git in dir with a fixed identity and fails the test on error.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// newTestRepo creates a repository on main cloned from a bare origin with
+// a "renamed" branch, and makes it the working directory, since the
+// model's actions run git there.
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	root := t.TempDir()
+	origin := filepath.Join(root, "origin.git")
+	runGit(t, root, "init", "-q", "--bare", "-b", "main", origin)
+
+	dir := filepath.Join(root, "work")
+	runGit(t, root, "init", "-q", "-b", "main", dir)
+	runGit(t, dir, "commit", "-q", "--allow-empty", "-m", "first")
+	runGit(t, dir, "remote", "add", "origin", origin)
+	runGit(t, dir, "push", "-q", "origin", "main", "main:renamed")
+	runGit(t, dir, "fetch", "-q", "origin", "main")
+	runGit(t, dir, "remote", "set-head", "origin", "main")
+
+	t.Chdir(dir)
+	return dir
+}
+
+func key(s string) tea.KeyMsg {
+	switch s {
+	case "esc":
+		return tea.KeyMsg{Type: tea.KeyEsc}
+	default:
+		return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+	}
+}
+
+// update feeds msg to m and returns the resulting model.
+func update(t *testing.T, m Model, msg tea.Msg) (Model, tea.Cmd) {
+	t.Helper()
+	next, cmd := m.Update(msg)
+	return next.(Model), cmd
+}
+
+func newTestModel(t *testing.T, dir string) Model {
+	t.Helper()
+	classifier := git.NewClassifier(git.NewClient(dir), offlineGitHub{}, nil)
+	m := NewModel(context.Background(), classifier, nil)
+	m, _ = update(t, m, tea.WindowSizeMsg{Width: 160, Height: 40})
+	return m
+}
+
+func TestDetachedModal(t *testing.T) {
+	tests := []struct {
+		name         string
+		key          string
+		operation    git.Operation
+		wantModal    bool
+		wantCheckout bool
+	}{
+		{name: "check out default branch", key: "c", wantCheckout: true},
+		{name: "stay", key: "s"},
+		{name: "escape stays", key: "esc"},
+		{name: "no checkout during an operation", key: "c", operation: git.OpBisect, wantModal: true},
+		{name: "other keys ignored", key: "j", wantModal: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newTestRepo(t)
+			runGit(t, dir, "checkout", "-q", "--detach")
+
+			status := git.GitStatus{IsDetached: true, HeadCommit: runGit(t, dir, "rev-parse", "HEAD"), HeadSubject: "first", Operation: tt.operation}
+			m, _ := update(t, newTestModel(t, dir), LoadBranchesMsg{status: status})
+			if !m.showDetached {
+				t.Fatal("modal not shown for a detached HEAD")
+			}
+			if view := m.View(); !strings.Contains(view, "HEAD is detached") {
+				t.Errorf("View() = %q, want the detached HEAD modal", view)
+			}
+
+			m, cmd := update(t, m, key(tt.key))
+			if m.showDetached != tt.wantModal {
+				t.Errorf("showDetached = %v, want %v", m.showDetached, tt.wantModal)
+			}
+
+			if !tt.wantCheckout {
+				if cmd != nil {
+					t.Errorf("key %q returned a command, want none", tt.key)
+				}
+				if got := runGit(t, dir, "rev-parse", "--abbrev-ref", "HEAD"); got != "HEAD" {
+					t.Errorf("HEAD = %s, want still detached", got)
+				}
+				return
+			}
+
+			if cmd == nil {
+				t.Fatal("key c returned no command, want a checkout")
+			}
+			msg, ok := cmd().(ActionMsg)
+			if !ok || msg.Action != "checkout" || msg.Branch != "main" || msg.Error != nil {
+				t.Fatalf("checkout command = %+v, want a checkout of main", msg)
+			}
+			if got := runGit(t, dir, "rev-parse", "--abbrev-ref", "HEAD"); got != "main" {
+				t.Errorf("HEAD = %s, want main", got)
+			}
+		})
+	}
+}
+
+func TestDetachedModalAsksOncePerSession(t *testing.T) {
+	dir := newTestRepo(t)
+	status := git.GitStatus{IsDetached: true}
+
+	m, _ := update(t, newTestModel(t, dir), LoadBranchesMsg{status: status})
+	m, _ = update(t, m, key("s"))
+	m, _ = update(t, m, LoadBranchesMsg{status: status})
+	if m.showDetached {
+		t.Error("modal shown again after choosing to stay")
+	}
+}
+
+func TestRetargetAction(t *testing.T) {
+	dir := newTestRepo(t)
+	runGit(t, dir, "branch", "old")
+	runGit(t, dir, "config", "branch.old.remote", "origin")
+	runGit(t, dir, "config", "branch.old.merge", "refs/heads/old")
+
+	renamed := git.Branch{Name: "old", State: git.RemoteRenamed, RenamedTo: "renamed", UpstreamRemote: "origin", TrackingRef: "origin/old"}
+	inSync := git.Branch{Name: "main", State: git.InSync, UpstreamRemote: "origin", TrackingRef: "origin/main"}
+	m, _ := update(t, newTestModel(t, dir), LoadBranchesMsg{branches: []git.Branch{inSync, renamed}})
+
+	// t does nothing on a branch that was not renamed.
+	if _, cmd := update(t, m, key("t")); cmd != nil {
+		t.Errorf("t on %s returned %+v, want no command", inSync.Name, cmd())
+	}
+
+	m, _ = update(t, m, key("j"))
+	m, cmd := update(t, m, key("t"))
+	if cmd == nil {
+		t.Fatal("t on a renamed branch returned no command")
+	}
+	confirmation, ok := cmd().(ConfirmationMsg)
+	if !ok || confirmation.Action != "retarget" || confirmation.Branch != "old" {
+		t.Fatalf("t returned %+v, want a retarget confirmation for old", confirmation)
+	}
+
+	m, _ = update(t, m, confirmation)
+	if view := m.View(); !strings.Contains(view, "origin/renamed") {
+		t.Errorf("View() = %q, want the confirmation naming origin/renamed", view)
+	}
+
+	m, cmd = update(t, m, key("y"))
+	if m.showConfirmDialog || cmd == nil {
+		t.Fatalf("y left the dialog open (%v) or returned no command", m.showConfirmDialog)
+	}
+	if msg, ok := cmd().(ActionMsg); !ok || msg.Action != "retarget" || msg.Error != nil {
+		t.Fatalf("retarget command = %+v, want success", msg)
+	}
+	if got := runGit(t, dir, "rev-parse", "--abbrev-ref", "old@{upstream}"); got != "origin/renamed" {
+		t.Errorf("old tracks %s, want origin/renamed", got)
+	}
+}
+
+func TestExplainAction(t *testing.T) {
+	branch := git.Branch{
+		Name:  "topic",
+		State: git.NoUpstream,
+		Trace: []git.TraceStep{{Rule: "upstream configured", Source: "branch.topic.merge", Result: "no"}},
+	}
+	m := NewModel(context.Background(), nil, nil)
+	m, _ = update(t, m, tea.WindowSizeMsg{Width: 160, Height: 40})
+	m, _ = update(t, m, LoadBranchesMsg{branches: []git.Branch{branch}})
+
+	if view := m.View(); !strings.Contains(view, "Branch: topic") {
+		t.Fatalf("View() = %q, want the details pane", view)
+	}
+
+	m, _ = update(t, m, key("e"))
+	view := m.View()
+	for _, want := range []string{"Why topic is " + git.NoUpstream.DisplayName(), "upstream configured", "=> NO_UPSTREAM"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("explain view missing %q:\n%s", want, view)
+		}
+	}
+
+	m, _ = update(t, m, key("e"))
+	if view := m.View(); !strings.Contains(view, "Branch: topic") || strings.Contains(view, "Why topic") {
+		t.Errorf("second e did not return to details:\n%s", view)
+	}
+}
@@ -3,6 +3,7 @@ package ui
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -35,6 +36,15 @@ func (m Model) headerView() string {
 		rightStyle.Render(right),
 	)
 
+	header += "\n"
+	if repo := m.repoStatusView(); repo != "" {
+		header += repo + "  "
+	}
+	header += m.authStatusView()
+	if limit := m.rateLimitView(); limit != "" {
+		header += "  " + limit
+	}
+
 	return lipgloss.NewStyle().
 		Width(m.width).
 		Height(2).
@@ -43,6 +53,54 @@ func (m Model) headerView() string {
 		Render(header)
 }
 
+// repoStatusView warns about a detached HEAD and any rebase, merge,
+// cherry-pick, revert or bisect in progress.
+func (m Model) repoStatusView() string {
+	var parts []string
+	if m.status.Operation != "" {
+		parts = append(parts, strings.ToUpper(string(m.status.Operation))+" in progress")
+	}
+	if m.status.IsDetached {
+		parts = append(parts, fmt.Sprintf("HEAD detached at %.7s", m.status.HeadCommit))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return lipgloss.NewStyle().Foreground(lipgloss.Color("11")).Render("⚠ " + strings.Join(parts, ", "))
+}
+
+// authStatusView shows where the token came from, or a warning when it
+// lacks permissions needed to read pull requests.
+func (m Model) authStatusView() string {
+	if m.githubClient == nil || m.githubClient.TokenInfo() == nil {
+		return ""
+	}
+
+	info := m.githubClient.TokenInfo()
+	if missing := info.MissingSummary(); missing != "" {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("11")).Render("⚠ " + missing)
+	}
+
+	return lipgloss.NewStyle().Faint(true).Render("Auth: " + info.Summary())
+}
+
+// rateLimitView shows the remaining API quota, highlighted when it runs
+// low or is exhausted.
+func (m Model) rateLimitView() string {
+	if !m.rateLimit.Known {
+		return ""
+	}
+
+	text := "API: " + m.rateLimit.String()
+	switch {
+	case m.rateLimit.Exhausted(time.Now()):
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render(text + " - using local git data")
+	case m.rateLimit.Low():
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("11")).Render(text)
+	}
+	return lipgloss.NewStyle().Faint(true).Render(text)
+}
+
 func (m Model) filterView() string {
 	content := "Filter Options:\n\n"
 	content += "a - All branches\n"
@@ -50,6 +108,9 @@ func (m Model) filterView() string {
 	content += "2 - PR branches\n"
 	content += "3 - Merged branches\n"
 	content += "4 - Ahead branches\n"
+	content += "5 - Behind branches\n"
+	content += "6 - No recent commits\n"
+	content += "7 - Upstream missing\n"
 	content += "/ - Search by name\n\n"
 
 	if m.filter.Mode == FilterBySearch {
@@ -68,6 +129,11 @@ func (m Model) filterView() string {
 }
 
 func (m Model) getStateColor(state git.BranchState) lipgloss.Color {
+	return StateColor(state)
+}
+
+// StateColor is the color branches in state are shown in.
+func StateColor(state git.BranchState) lipgloss.Color {
 	switch state {
 	case git.StaleLocal:
 		return lipgloss.Color("9") // Red
@@ -81,8 +147,10 @@ func (m Model) getStateColor(state git.BranchState) lipgloss.Color {
 		return lipgloss.Color("13") // Magenta
 	case git.BehindRemote:
 		return lipgloss.Color("14") // Cyan
-	case git.Diverged:
+	case git.Diverged, git.UpstreamChanged, git.UpstreamGone:
 		return lipgloss.Color("9") // Red
+	case git.RemoteRenamed:
+		return lipgloss.Color("11") // Yellow
 	case git.InSync:
 		return lipgloss.Color("10") // Green
 	default:
@@ -128,6 +196,27 @@ func (m Model) handleFilterKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.showFilter = false
 		}
 		return m, nil
+	case "5":
+		if filter, ok := PredefinedFilters["Behind"]; ok {
+			m.filter = &filter
+			m.updateFilteredBranches()
+			m.showFilter = false
+		}
+		return m, nil
+	case "6":
+		if filter, ok := PredefinedFilters["Old"]; ok {
+			m.filter = &filter
+			m.updateFilteredBranches()
+			m.showFilter = false
+		}
+		return m, nil
+	case "7":
+		if filter, ok := PredefinedFilters["Upstream Missing"]; ok {
+			m.filter = &filter
+			m.updateFilteredBranches()
+			m.showFilter = false
+		}
+		return m, nil
 	case "/":
 		m.filter.SetSearchFilter("")
 		m.searchInput = ""